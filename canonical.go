@@ -0,0 +1,274 @@
+package msgpack
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"math"
+	"sort"
+)
+
+// canonicalNaN is the float 32 bit pattern every NaN is written as in
+// canonical form.
+const canonicalNaN uint32 = 0x7FC00000
+
+// Canonicalize re-encodes the single MessagePack value in data in canonical
+// form, so that equal values produced by any implementation yield the same
+// bytes:
+//   - map entries are sorted bytewise by the encoding of their keys
+//   - integers, strings, bin, ext, arrays and maps use their smallest format,
+//     with non-negative integers always in the unsigned formats
+//   - floats use float 32 when that is lossless, and NaN is a single quiet NaN
+//   - timestamps use their smallest layout
+//
+// Integers and floats keep their family: 1.0 stays a float.
+func Canonicalize(data []byte) ([]byte, error) {
+	dec := NewMessagePackDecoder(data)
+
+	var buf bytes.Buffer
+	if err := dec.canonicalize(&buf); err != nil {
+		return nil, newDecodeError(err, 0, 0)
+	}
+
+	offset := dec.reader.offset
+	if b, err := dec.reader.ReadByte(); err != io.EOF {
+		return nil, &DecodeError{Offset: offset, Format: b, Err: ErrTrailingData}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Hash returns the SHA-256 digest of the canonical form of data, a stable
+// identifier for the value it encodes.
+func Hash(data []byte) ([sha256.Size]byte, error) {
+	canonical, err := Canonicalize(data)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+
+	return sha256.Sum256(canonical), nil
+}
+
+func (dec *MessagePackDecoder) canonicalize(buf writer) (err error) {
+	b, offset, err := dec.readFormat()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			err = newDecodeError(err, offset, b)
+		}
+	}()
+
+	dec.traceFormat("canonicalize", offset, b)
+
+	switch {
+	// fixmap
+	case b >= 0x80 && b <= 0x8F:
+		return dec.canonicalizeMap(buf, int(b&0x0F))
+
+	// map 16, map 32
+	case b == 0xDE || b == 0xDF:
+		length, err := dec.readLength(16 << (b - 0xDE))
+		if err != nil {
+			return err
+		}
+		return dec.canonicalizeMap(buf, int(length))
+
+	// fixarray
+	case b >= 0x90 && b <= 0x9F:
+		return dec.canonicalizeArray(buf, int(b&0x0F))
+
+	// array 16, array 32
+	case b == 0xDC || b == 0xDD:
+		length, err := dec.readLength(16 << (b - 0xDC))
+		if err != nil {
+			return err
+		}
+		return dec.canonicalizeArray(buf, int(length))
+
+	// fixext 1/2/4/8/16
+	case b >= 0xD4 && b <= 0xD8:
+		ext, err := dec.readExt(1 << (b - 0xD4))
+		if err != nil {
+			return err
+		}
+		return encodeCanonicalExt(buf, ext)
+
+	// ext 8, ext 16, ext 32
+	case b >= 0xC7 && b <= 0xC9:
+		ext, err := dec.readExtWithLengthInBits(8 << (b - 0xC7))
+		if err != nil {
+			return err
+		}
+		return encodeCanonicalExt(buf, ext)
+	}
+
+	data, err := dec.decodeFormat(b)
+	if err != nil {
+		return err
+	}
+
+	switch v := data.(type) {
+	case nil:
+		return encodeNil(buf, v)
+	case bool:
+		return encodeBool(buf, v)
+	case string:
+		return encodeString(buf, v)
+	case []byte:
+		return encodeBin(buf, v)
+	case float32:
+		if math.IsNaN(float64(v)) {
+			return encodeFloat32(buf, math.Float32frombits(canonicalNaN))
+		}
+		return encodeFloat32(buf, v)
+	case float64:
+		return encodeCanonicalFloat(buf, v)
+	case uint8:
+		return encodeUint(buf, uint64(v))
+	case uint16:
+		return encodeUint(buf, uint64(v))
+	case uint32:
+		return encodeUint(buf, uint64(v))
+	case uint64:
+		return encodeUint(buf, v)
+	case int8:
+		return encodeCanonicalInt(buf, int64(v))
+	case int16:
+		return encodeCanonicalInt(buf, int64(v))
+	case int32:
+		return encodeCanonicalInt(buf, int64(v))
+	case int64:
+		return encodeCanonicalInt(buf, v)
+	default:
+		return ErrUnsupportedType
+	}
+}
+
+func (dec *MessagePackDecoder) canonicalizeArray(buf writer, length int) error {
+	if err := dec.enterContainer(length, 1); err != nil {
+		return err
+	}
+	defer dec.leaveContainer()
+
+	if err := encodeArrayHeader(buf, length); err != nil {
+		return err
+	}
+
+	for i := 0; i < length; i++ {
+		if err := dec.canonicalize(buf); err != nil {
+			return withIndex(err, i)
+		}
+	}
+
+	return nil
+}
+
+func (dec *MessagePackDecoder) canonicalizeMap(buf writer, length int) error {
+	if err := dec.enterContainer(length, 2); err != nil {
+		return err
+	}
+	defer dec.leaveContainer()
+
+	type entry struct {
+		key   bytes.Buffer
+		value bytes.Buffer
+	}
+
+	var entries []*entry
+	for i := 0; i < length; i++ {
+		e := &entry{}
+		if err := dec.canonicalize(&e.key); err != nil {
+			return err
+		}
+		if err := dec.canonicalize(&e.value); err != nil {
+			key, _ := NewMessagePackDecoder(e.key.Bytes()).Decode()
+			return withKey(err, key)
+		}
+		entries = append(entries, e)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].key.Bytes(), entries[j].key.Bytes()) < 0
+	})
+
+	if err := encodeMapHeader(buf, length); err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if _, err := buf.Write(e.key.Bytes()); err != nil {
+			return err
+		}
+		if _, err := buf.Write(e.value.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func encodeCanonicalInt(buf writer, value int64) error {
+	if value >= 0 {
+		return encodeUint(buf, uint64(value))
+	}
+	return encodeInt(buf, value)
+}
+
+func encodeCanonicalFloat(buf writer, value float64) error {
+	if math.IsNaN(value) {
+		return encodeFloat32(buf, math.Float32frombits(canonicalNaN))
+	}
+	return encodeFloat(buf, value)
+}
+
+// encodeCanonicalExt rewrites valid timestamps in their smallest layout and
+// keeps every other extension payload as is.
+func encodeCanonicalExt(buf writer, ext Ext) error {
+	if ext.Type == timestampExtType {
+		if t, err := decodeTimestamp(ext.Data); err == nil {
+			return encodeTimestamp(buf, t)
+		}
+	}
+	return encodeExt(buf, ext.Type, ext.Data)
+}
+
+// canonicalStringLess orders strings the way their MessagePack encodings
+// compare bytewise: shorter strings first, then by content.
+func canonicalStringLess(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+func sortCanonicalStrings(keys []string) {
+	sort.Slice(keys, func(i, j int) bool {
+		return canonicalStringLess(keys[i], keys[j])
+	})
+}
+
+// sortEncodedKeys encodes n map keys with encodeKey and returns them in
+// canonical order, bytewise by their encoding, along with the index of the
+// key each came from.
+func (es *encodeState) sortEncodedKeys(n int, encodeKey func(kes *encodeState, i int) error) ([][]byte, []int, error) {
+	keys := make([][]byte, n)
+	order := make([]int, n)
+	for i := 0; i < n; i++ {
+		var buf bytes.Buffer
+		kes := newEncodeState(&buf, es.opts)
+		if err := encodeKey(kes, i); err != nil {
+			return nil, nil, err
+		}
+		keys[i] = buf.Bytes()
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return bytes.Compare(keys[order[i]], keys[order[j]]) < 0
+	})
+
+	return keys, order, nil
+}
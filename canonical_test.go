@@ -0,0 +1,135 @@
+package msgpack
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"testing"
+)
+
+func TestEncoderCanonical(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   interface{}
+		encoded []byte
+	}{
+		{name: "sorted map keys", value: map[string]interface{}{"cc": 1, "b": 2, "a": 3}, encoded: []byte{0x83, 0xA1, 'a', 0x03, 0xA1, 'b', 0x02, 0xA2, 'c', 'c', 0x01}},
+		{name: "sorted typed map keys", value: map[string]int{"bb": 1, "a": 2}, encoded: []byte{0x82, 0xA1, 'a', 0x02, 0xA2, 'b', 'b', 0x01}},
+		{name: "sorted int map keys", value: map[int]bool{300: true, -1: false, 2: true}, encoded: []byte{0x83, 0x02, 0xC3, 0xCD, 0x01, 0x2C, 0xC3, 0xFF, 0xC2}},
+		{name: "sorted mixed map keys", value: map[interface{}]interface{}{"a": 1, uint8(1): 2}, encoded: []byte{0x82, 0x01, 0x02, 0xA1, 'a', 0x01}},
+		{name: "sorted struct fields", value: testPoint{X: 1, Y: 2}, encoded: []byte{0x82, 0xA1, 'x', 0x01, 0xA1, 'y', 0x02}},
+		{name: "unsigned format for positive int", value: 200, encoded: []byte{0xCC, 0xC8}},
+		{name: "signed format for negative int", value: int64(-200), encoded: []byte{0xD1, 0xFF, 0x38}},
+		{name: "float 32 when lossless", value: 1.5, encoded: []byte{0xCA, 0x3F, 0xC0, 0x00, 0x00}},
+		{name: "NaN", value: math.NaN(), encoded: []byte{0xCA, 0x7F, 0xC0, 0x00, 0x00}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := NewEncoderWithOptions(&out, EncoderOptions{Canonical: true}).Encode(tt.value); err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			if !bytes.Equal(out.Bytes(), tt.encoded) {
+				t.Errorf("Encode() = % X, want % X", out.Bytes(), tt.encoded)
+			}
+		})
+	}
+}
+
+func TestCanonicalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []byte
+		expected []byte
+	}{
+		{name: "uint 16 to fixint", input: []byte{0xCD, 0x00, 0x05}, expected: []byte{0x05}},
+		{name: "int 16 to uint 8", input: []byte{0xD1, 0x00, 0xC8}, expected: []byte{0xCC, 0xC8}},
+		{name: "int 64 to negative fixint", input: []byte{0xD3, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, expected: []byte{0xFF}},
+		{name: "float 64 to float 32", input: []byte{0xCB, 0x3F, 0xF8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, expected: []byte{0xCA, 0x3F, 0xC0, 0x00, 0x00}},
+		{name: "float keeps its family", input: []byte{0xCB, 0x3F, 0xF0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, expected: []byte{0xCA, 0x3F, 0x80, 0x00, 0x00}},
+		{name: "NaN payload", input: []byte{0xCB, 0x7F, 0xF8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01}, expected: []byte{0xCA, 0x7F, 0xC0, 0x00, 0x00}},
+		{name: "str 8 to fixstr", input: []byte{0xD9, 0x01, 'a'}, expected: []byte{0xA1, 'a'}},
+		{name: "bin 16 to bin 8", input: []byte{0xC5, 0x00, 0x01, 0xFF}, expected: []byte{0xC4, 0x01, 0xFF}},
+		{name: "ext 8 to fixext 1", input: []byte{0xC7, 0x01, 0x05, 0xAA}, expected: []byte{0xD4, 0x05, 0xAA}},
+		{name: "timestamp 96 to timestamp 32", input: []byte{0xC7, 0x0C, 0xFF, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x01}, expected: []byte{0xD6, 0xFF, 0x00, 0x00, 0x00, 0x01}},
+		{name: "array 16 to fixarray", input: []byte{0xDC, 0x00, 0x02, 0xCC, 0x01, 0xC0}, expected: []byte{0x92, 0x01, 0xC0}},
+		{
+			name:     "map 16 sorted",
+			input:    []byte{0xDE, 0x00, 0x03, 0xA2, 'b', 'b', 0x01, 0xA1, 'z', 0x02, 0x05, 0x03},
+			expected: []byte{0x83, 0x05, 0x03, 0xA1, 'z', 0x02, 0xA2, 'b', 'b', 0x01},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Canonicalize(tt.input)
+			if err != nil {
+				t.Fatalf("Canonicalize() error = %v", err)
+			}
+			if !bytes.Equal(got, tt.expected) {
+				t.Errorf("Canonicalize() = % X, want % X", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCanonicalizeMatchesEncoder(t *testing.T) {
+	value := map[string]interface{}{
+		"name":   "record",
+		"count":  300,
+		"ratio":  0.1,
+		"nested": map[string]interface{}{"z": -1, "a": []interface{}{true, nil}},
+	}
+
+	var out bytes.Buffer
+	if err := NewEncoderWithOptions(&out, EncoderOptions{Canonical: true}).Encode(value); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	plain, err := Marshal(value)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	canonical, err := Canonicalize(plain)
+	if err != nil {
+		t.Fatalf("Canonicalize() error = %v", err)
+	}
+	if !bytes.Equal(canonical, out.Bytes()) {
+		t.Errorf("Canonicalize() = % X, want % X", canonical, out.Bytes())
+	}
+}
+
+func TestCanonicalizeErrors(t *testing.T) {
+	if _, err := Canonicalize([]byte{0x01, 0x02}); !errors.Is(err, ErrTrailingData) {
+		t.Errorf("Canonicalize() error = %v, wantErr %v", err, ErrTrailingData)
+	}
+	if _, err := Canonicalize([]byte{0x92, 0x01, 0xCD}); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Canonicalize() error = %v, wantErr %v", err, io.ErrUnexpectedEOF)
+	}
+	if _, err := Canonicalize([]byte{0xC1}); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("Canonicalize() error = %v, wantErr %v", err, ErrUnsupportedType)
+	}
+}
+
+func TestHash(t *testing.T) {
+	a, err := Hash([]byte{0x82, 0xA1, 'a', 0x01, 0xA1, 'b', 0x02})
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+	b, err := Hash([]byte{0xDE, 0x00, 0x02, 0xA1, 'b', 0xCD, 0x00, 0x02, 0xD9, 0x01, 'a', 0xD0, 0x01})
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+	if a != b {
+		t.Errorf("Hash() differs for equal values: %X != %X", a, b)
+	}
+
+	c, err := Hash([]byte{0x82, 0xA1, 'a', 0x01, 0xA1, 'b', 0x03})
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+	if a == c {
+		t.Errorf("Hash() equal for different values")
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mu8086/msgpack"
+	"github.com/spf13/viper"
+)
+
+// loadOptions builds the library options from the loaded configuration.
+// Keys that are not set keep the library defaults.
+func loadOptions(v *viper.Viper) (msgpack.Options, error) {
+	opts := msgpack.Options{
+		BinaryKeyword: v.GetString("binary_keyword"),
+		TypedJSON:     v.GetBool("typed_json"),
+		Encoder: msgpack.EncoderOptions{
+			Canonical: v.GetBool("canonical"),
+		},
+		Decoder: msgpack.DecoderOptions{
+			MaxDepth:        v.GetInt("max_depth"),
+			MaxContainerLen: v.GetInt("max_container_len"),
+			MaxStringLen:    v.GetInt("max_string_len"),
+			MaxBinLen:       v.GetInt("max_bin_len"),
+			MaxAlloc:        v.GetInt("max_alloc"),
+		},
+	}
+
+	if path := v.GetString("mapping_file"); path != "" {
+		mapping, err := loadMapping(path)
+		if err != nil {
+			return msgpack.Options{}, err
+		}
+		opts.Mapping = mapping
+	}
+
+	return opts, nil
+}
+
+// loadMapping reads the rules list of a TOML or YAML mapping file.
+func loadMapping(path string) (*msgpack.Mapping, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("mapping file: %w", err)
+	}
+
+	mapping, err := msgpack.ParseMapping(v.GetStringSlice("rules"))
+	if err != nil {
+		return nil, fmt.Errorf("mapping file %s: %w", path, err)
+	}
+	return mapping, nil
+}
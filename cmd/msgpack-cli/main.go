@@ -3,21 +3,22 @@ package main
 import (
 	"fmt"
 
-	"github.com/mu8086/msgpack"
 	"github.com/spf13/viper"
 )
 
 func main() {
-	viper.SetConfigName("config")
-	viper.SetConfigType("toml")
-	viper.AddConfigPath(".")
-	err := viper.ReadInConfig()
+	v := viper.New()
+	v.SetConfigName("config")
+	v.SetConfigType("toml")
+	v.AddConfigPath(".")
+	err := v.ReadInConfig()
 	if err != nil {
 		panic(fmt.Errorf("fatal error config file: %w", err))
 	}
 
-	if err := msgpack.InitConstants(); err != nil {
-		panic(fmt.Errorf(err.Error()))
+	opts, err := loadOptions(v)
+	if err != nil {
+		panic(fmt.Errorf("fatal error config file: %w", err))
 	}
 
 	jsonData := []byte(
@@ -67,10 +68,10 @@ func main() {
 			"favoriteFruit": "strawberry"
 		}`)
 
-	mp, err := msgpack.JSONToMessagePack(jsonData)
+	mp, err := opts.JSONToMessagePack(jsonData)
 	fmt.Printf("mp: %v, err: %v\n", formatBytecode(mp), err)
 
-	jsonData2, err := msgpack.MessagePackToJSON(mp)
+	jsonData2, err := opts.MessagePackToJSON(mp)
 	fmt.Printf("jsonData2: %v, err: %v\n", jsonData2, err)
 }
 
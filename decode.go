@@ -1,30 +1,186 @@
 package msgpack
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/binary"
-	"fmt"
+	"io"
+	"log/slog"
+	"reflect"
 )
 
+// reader is the source the decoder reads from. Both *bytes.Reader and
+// *bufio.Reader satisfy it.
+type reader interface {
+	io.Reader
+	io.ByteScanner
+}
+
+// DecoderOptions configures a MessagePackDecoder. The zero value decodes
+// like NewMessagePackDecoder.
+type DecoderOptions struct {
+	// ExtRegistry maps extension types to Go types, overriding the types
+	// registered with RegisterExt; IDs it does not define fall back to
+	// those. Nil uses the registered types alone.
+	ExtRegistry *ExtRegistry
+
+	// Logger receives debug traces of every format read and of limits
+	// being hit. Nil keeps the decoder silent.
+	Logger *slog.Logger
+
+	// MaxDepth bounds how deeply arrays and maps may nest. Zero uses
+	// DefaultMaxDepth and a negative value disables the check.
+	MaxDepth int
+
+	// MaxContainerLen bounds the number of elements of an array and of
+	// entries of a map. Zero means no limit.
+	MaxContainerLen int
+
+	// MaxStringLen bounds the length of a str payload. Zero means no limit.
+	MaxStringLen int
+
+	// MaxBinLen bounds the length of a bin or ext payload. Zero means no
+	// limit.
+	MaxBinLen int
+
+	// MaxAlloc bounds the memory a single decoded value may claim for its
+	// payloads and container slots. Zero means no limit.
+	MaxAlloc int
+}
+
 type MessagePackDecoder struct {
-	reader *bytes.Reader
+	reader *offsetReader
+	opts   DecoderOptions
+
+	// depth and allocated track the value being decoded for the limits
+	// in DecoderOptions
+	depth     int
+	allocated int
+
+	// tokens holds the arrays and maps opened by Token that are not closed
+	tokens []tokenFrame
 }
 
 func NewMessagePackDecoder(data []byte) *MessagePackDecoder {
 	return &MessagePackDecoder{
-		reader: bytes.NewReader(data),
+		reader: &offsetReader{r: bytes.NewReader(data)},
 	}
 }
 
+// NewDecoder returns a decoder reading consecutive values from r. Readers
+// that do not implement io.ByteScanner are wrapped in a bufio.Reader, so the
+// decoder may read past the value it returns.
+func NewDecoder(r io.Reader) *MessagePackDecoder {
+	return NewDecoderWithOptions(r, DecoderOptions{})
+}
+
+// NewDecoderWithOptions is like NewDecoder but configured by opts.
+func NewDecoderWithOptions(r io.Reader, opts DecoderOptions) *MessagePackDecoder {
+	rd, ok := r.(reader)
+	if !ok {
+		rd = bufio.NewReader(r)
+	}
+
+	return &MessagePackDecoder{
+		reader: &offsetReader{r: rd},
+		opts:   opts,
+	}
+}
+
+// offsetReader counts the bytes consumed from r, so errors can point at
+// where they happened.
+type offsetReader struct {
+	r      reader
+	offset int64
+}
+
+func (or *offsetReader) Read(p []byte) (int, error) {
+	n, err := or.r.Read(p)
+	or.offset += int64(n)
+	return n, err
+}
+
+func (or *offsetReader) ReadByte() (byte, error) {
+	b, err := or.r.ReadByte()
+	if err == nil {
+		or.offset++
+	}
+	return b, err
+}
+
+func (or *offsetReader) UnreadByte() error {
+	err := or.r.UnreadByte()
+	if err == nil {
+		or.offset--
+	}
+	return err
+}
+
+// Decode reads the next value from the input. It returns io.EOF when the
+// input ends cleanly before a value; every other error is a *DecodeError,
+// with io.ErrUnexpectedEOF as the cause when the input ends inside a value.
+//
+// Inside an array or map opened by Token, Decode reads the next element,
+// key or value as a whole, and fails with ErrEndOfContainer when there is
+// none left.
 func (dec *MessagePackDecoder) Decode() (interface{}, error) {
-	tag := "[MessagePackDecoder.Decode]"
+	if n := len(dec.tokens); n > 0 {
+		top := &dec.tokens[n-1]
+		if top.remaining == 0 {
+			return nil, &DecodeError{Offset: dec.reader.offset, Err: ErrEndOfContainer}
+		}
+		top.remaining--
 
-	b, err := dec.reader.ReadByte()
+		// the allocation budget is per value handed out
+		dec.allocated = 0
+	}
+
+	return dec.decode()
+}
+
+// decode reads the next value, for Decode and for the values nested in it.
+func (dec *MessagePackDecoder) decode() (interface{}, error) {
+	b, offset, err := dec.readFormat()
 	if err != nil {
-		fmt.Printf("%v ReadByte failed, err: %v\n", tag, err)
+		return nil, err
+	}
+	dec.traceFormat("decode", offset, b)
+
+	// the allocation budget is per top-level value
+	if dec.depth == 0 {
+		dec.allocated = 0
+	}
+
+	data, err := dec.decodeFormat(b)
+	if err != nil {
+		err = newDecodeError(err, offset, b)
+		if dec.depth == 0 {
+			dec.traceError("decode failed", err)
+		}
 		return nil, err
 	}
 
+	return data, nil
+}
+
+// readFormat reads the format byte of the next value and returns it along
+// with its offset. Only a top-level value may find the input ended cleanly.
+func (dec *MessagePackDecoder) readFormat() (byte, int64, error) {
+	offset := dec.reader.offset
+
+	b, err := dec.reader.ReadByte()
+	if err != nil {
+		if err == io.EOF && dec.depth == 0 {
+			return 0, offset, err
+		}
+		return 0, offset, &DecodeError{Offset: offset, Err: unexpectedEOF(err)}
+	}
+
+	return b, offset, nil
+}
+
+// decodeFormat decodes the value introduced by format byte b.
+func (dec *MessagePackDecoder) decodeFormat(b byte) (interface{}, error) {
 	switch {
 	// positive fixint
 	case b >= 0x00 && b <= 0x7F:
@@ -51,7 +207,6 @@ func (dec *MessagePackDecoder) Decode() (interface{}, error) {
 
 	// never used
 	case b == 0xC1:
-		fmt.Printf("%v 0x%02X not used in MessagePack\n", tag, b)
 		return nil, ErrUnsupportedType
 
 	// false
@@ -76,12 +231,15 @@ func (dec *MessagePackDecoder) Decode() (interface{}, error) {
 
 	// ext 8
 	case b == 0xC7:
+		return dec.resolveExt(dec.readExtWithLengthInBits(8))
 
 	// ext 16
 	case b == 0xC8:
+		return dec.resolveExt(dec.readExtWithLengthInBits(16))
 
 	// ext 32
 	case b == 0xC9:
+		return dec.resolveExt(dec.readExtWithLengthInBits(32))
 
 	// float 32
 	case b == 0xCA:
@@ -125,18 +283,23 @@ func (dec *MessagePackDecoder) Decode() (interface{}, error) {
 
 	// fixext 1
 	case b == 0xD4:
+		return dec.resolveExt(dec.readExt(1))
 
 	// fixext 2
 	case b == 0xD5:
+		return dec.resolveExt(dec.readExt(2))
 
 	// fixext 4
 	case b == 0xD6:
+		return dec.resolveExt(dec.readExt(4))
 
 	// fixext 8
 	case b == 0xD7:
+		return dec.resolveExt(dec.readExt(8))
 
 	// fixext 16
 	case b == 0xD8:
+		return dec.resolveExt(dec.readExt(16))
 
 	// str 8
 	case b == 0xD9:
@@ -171,37 +334,58 @@ func (dec *MessagePackDecoder) Decode() (interface{}, error) {
 		return int8(b), nil
 
 	default:
-		fmt.Printf("%v 0x%02X not defined in MessagePack\n", tag, b)
 		return "", ErrUnsupportedType
 	}
+}
+
+// readContainerHeader reads the length of the array or map introduced by b.
+// isContainer is false for every other format.
+func (dec *MessagePackDecoder) readContainerHeader(b byte) (length int, isMap, isContainer bool, err error) {
+	var lengthInBits int
+	switch {
+	case b >= 0x80 && b <= 0x8F:
+		return int(b & 0x0F), true, true, nil
+	case b >= 0x90 && b <= 0x9F:
+		return int(b & 0x0F), false, true, nil
+	case b == 0xDC:
+		lengthInBits = 16
+	case b == 0xDD:
+		lengthInBits = 32
+	case b == 0xDE:
+		lengthInBits, isMap = 16, true
+	case b == 0xDF:
+		lengthInBits, isMap = 32, true
+	default:
+		return 0, false, false, nil
+	}
 
-	return "", nil
+	n, err := dec.readLength(lengthInBits)
+	return int(n), isMap, true, err
 }
 
 func (dec *MessagePackDecoder) readArray(length int) ([]interface{}, error) {
-	tag := "[MessagePackDecoder.readArray]"
+	if err := dec.enterContainer(length, 1); err != nil {
+		return nil, err
+	}
+	defer dec.leaveContainer()
 
-	data := make([]interface{}, length, length)
+	data := make([]interface{}, 0, dec.capHint(length))
 
 	for i := 0; i < int(length); i++ {
-		element, err := dec.Decode()
+		element, err := dec.decode()
 		if err != nil {
-			fmt.Printf("%v Decode failed, err: %v\n", tag, err)
-			return nil, err
+			return nil, withIndex(err, i)
 		}
 
-		data[i] = element
+		data = append(data, element)
 	}
 
 	return data, nil
 }
 
 func (dec *MessagePackDecoder) readArrayWithLengthInBits(lengthInBits int) ([]interface{}, error) {
-	tag := "[MessagePackDecoder.readArrayWithLengthInBits]"
-
 	length, err := dec.readLength(lengthInBits)
 	if err != nil {
-		fmt.Printf("%v readLength failed, err: %v\n", tag, err)
 		return nil, err
 	}
 
@@ -209,24 +393,42 @@ func (dec *MessagePackDecoder) readArrayWithLengthInBits(lengthInBits int) ([]in
 }
 
 func (dec *MessagePackDecoder) readBinWithLengthInBits(lengthInBits int) ([]byte, error) {
-	tag := "[MessagePackDecoder.readBinWithLengthInBits]"
-
 	length, err := dec.readLength(lengthInBits)
 	if err != nil {
-		fmt.Printf("%v readLength failed, err: %v\n", tag, err)
 		return nil, err
 	}
 
-	binData := make([]byte, length, length)
-	err = binary.Read(dec.reader, binary.BigEndian, &binData)
+	binData, err := dec.readBytes(int(length), dec.opts.MaxBinLen, ErrMaxBinLenExceeded)
 	if err != nil {
-		fmt.Printf("%v Read failed, err: %v\n", tag, err)
 		return nil, err
 	}
 
 	return binData, nil
 }
 
+func (dec *MessagePackDecoder) readExt(length int) (Ext, error) {
+	extType, err := dec.readInt8()
+	if err != nil {
+		return Ext{}, err
+	}
+
+	data, err := dec.readBytes(length, dec.opts.MaxBinLen, ErrMaxBinLenExceeded)
+	if err != nil {
+		return Ext{}, err
+	}
+
+	return Ext{Type: extType, Data: data}, nil
+}
+
+func (dec *MessagePackDecoder) readExtWithLengthInBits(lengthInBits int) (Ext, error) {
+	length, err := dec.readLength(lengthInBits)
+	if err != nil {
+		return Ext{}, err
+	}
+
+	return dec.readExt(int(length))
+}
+
 func (dec *MessagePackDecoder) readFloat32() (data float32, err error) {
 	err = binary.Read(dec.reader, binary.BigEndian, &data)
 	return data, err
@@ -258,11 +460,8 @@ func (dec *MessagePackDecoder) readInt64() (data int64, err error) {
 }
 
 func (dec *MessagePackDecoder) readLength(bits int) (int64, error) {
-	tag := "[MessagePackDecoder.readLength]"
-
 	// not a multiple of 8
 	if (bits & 0x7) != 0 {
-		fmt.Printf("%v bits(%v) not a multiple of 8\n", tag, bits)
 		return 0, ErrLengthInvalid
 	}
 
@@ -270,11 +469,13 @@ func (dec *MessagePackDecoder) readLength(bits int) (int64, error) {
 	byteSize := bits >> 3
 
 	for i := 1; i <= byteSize; i++ {
-		length <<= 4
+		length <<= 8
 
 		b, err := dec.reader.ReadByte()
 		if err != nil {
-			fmt.Printf("%v ReadByte failed, err: %v\n", tag, err)
+			if err == io.EOF {
+				return 0, io.ErrUnexpectedEOF
+			}
 			return 0, ErrReadByte
 		}
 
@@ -284,42 +485,107 @@ func (dec *MessagePackDecoder) readLength(bits int) (int64, error) {
 	return length, nil
 }
 
-func (dec *MessagePackDecoder) readMap(length int) (map[string]interface{}, error) {
-	tag := "[MessagePackDecoder.readMap]"
+// readMap returns a map[string]interface{} when every key is a string, as
+// maps written from JSON are, and a map[interface{}]interface{} otherwise.
+func (dec *MessagePackDecoder) readMap(length int) (interface{}, error) {
+	if err := dec.enterContainer(length, 2); err != nil {
+		return nil, err
+	}
+	defer dec.leaveContainer()
 
-	m := make(map[string]interface{}, length)
+	m := make(map[string]interface{}, dec.capHint(length))
+	var anyMap map[interface{}]interface{}
+	var binKeys binKeySet
 
 	for i := 0; i < length; i++ {
-		key, err := dec.Decode()
+		key, err := dec.decode()
 		if err != nil {
-			fmt.Printf("%v Decode key failed, err: %v\n", tag, err)
 			return nil, err
 		}
 
-		keyStr, ok := key.(string)
-		if !ok {
-			fmt.Printf("%v key not a string\n", tag)
-			return nil, ErrUnsupportedType
+		_, fromBin := key.([]byte)
+		key, err = mapKey(key)
+		if err != nil {
+			return nil, err
 		}
 
-		value, err := dec.Decode()
+		if keyStr, ok := key.(string); ok {
+			var exists bool
+			if anyMap != nil {
+				_, exists = anyMap[keyStr]
+			} else {
+				_, exists = m[keyStr]
+			}
+			if err := binKeys.add(keyStr, fromBin, exists); err != nil {
+				return nil, err
+			}
+		}
+
+		value, err := dec.decode()
 		if err != nil {
-			fmt.Printf("%v Decode value failed, err: %v\n", tag, err)
-			return nil, err
+			return nil, withKey(err, key)
+		}
+
+		if anyMap == nil {
+			if keyStr, ok := key.(string); ok {
+				m[keyStr] = value
+				continue
+			}
+
+			// first non-string key, move what we have so far over
+			anyMap = make(map[interface{}]interface{}, dec.capHint(length))
+			for k, v := range m {
+				anyMap[k] = v
+			}
 		}
 
-		m[keyStr] = value
+		anyMap[key] = value
 	}
 
+	if anyMap != nil {
+		return anyMap, nil
+	}
 	return m, nil
 }
 
-func (dec *MessagePackDecoder) readMapWithLengthInBits(lengthInBits int) (map[string]interface{}, error) {
-	tag := "[MessagePackDecoder.readMapWithLengthInBits]"
+// binKeySet remembers which string keys of a map were decoded from bin. It
+// is only allocated once a bin key turns up.
+type binKeySet map[string]bool
+
+// add records key, decoded from a bin when fromBin, and fails with
+// ErrMapKeyCollision when the map already holds the same bytes as a key of
+// the other kind, which would otherwise silently replace it.
+func (s *binKeySet) add(key string, fromBin, exists bool) error {
+	if exists && (*s)[key] != fromBin {
+		return ErrMapKeyCollision
+	}
+	if fromBin {
+		if *s == nil {
+			*s = make(binKeySet)
+		}
+		(*s)[key] = true
+	}
+	return nil
+}
+
+// mapKey turns a decoded key into one a Go map can hold: bin keys become
+// strings, and keys that are not comparable, such as arrays, maps and raw
+// extension values, are rejected.
+func mapKey(key interface{}) (interface{}, error) {
+	if b, ok := key.([]byte); ok {
+		return string(b), nil
+	}
+
+	if key != nil && !reflect.TypeOf(key).Comparable() {
+		return nil, ErrUnsupportedType
+	}
+
+	return key, nil
+}
 
+func (dec *MessagePackDecoder) readMapWithLengthInBits(lengthInBits int) (interface{}, error) {
 	length, err := dec.readLength(lengthInBits)
 	if err != nil {
-		fmt.Printf("%v readLength failed, err: %v\n", tag, err)
 		return nil, err
 	}
 
@@ -327,11 +593,8 @@ func (dec *MessagePackDecoder) readMapWithLengthInBits(lengthInBits int) (map[st
 }
 
 func (dec *MessagePackDecoder) readStrWithLengthInBits(lengthInBits int) (string, error) {
-	tag := "[MessagePackDecoder.readStrWithLengthInBits]"
-
 	length, err := dec.readLength(lengthInBits)
 	if err != nil {
-		fmt.Printf("%v readLength failed, err: %v\n", tag, err)
 		return "", err
 	}
 
@@ -339,55 +602,40 @@ func (dec *MessagePackDecoder) readStrWithLengthInBits(lengthInBits int) (string
 }
 
 func (dec *MessagePackDecoder) readString(length int) (string, error) {
-	tag := "[MessagePackDecoder.readString]"
-
-	buf := make([]byte, length)
-	if _, err := dec.reader.Read(buf); err != nil {
-		fmt.Printf("%v Read failed, err: %v\n", tag, err)
+	buf, err := dec.readBytes(length, dec.opts.MaxStringLen, ErrMaxStringLenExceeded)
+	if err != nil {
 		return "", err
 	}
 	return string(buf), nil
 }
 
 func (dec *MessagePackDecoder) readUint8() (data uint8, err error) {
-	tag := "[MessagePackDecoder.readUint8]"
-
 	err = binary.Read(dec.reader, binary.BigEndian, &data)
 	if err != nil {
-		fmt.Printf("%v Read failed, err: %v\n", tag, err)
 		return 0, err
 	}
 	return data, nil
 }
 
 func (dec *MessagePackDecoder) readUint16() (data uint16, err error) {
-	tag := "[MessagePackDecoder.readUint16]"
-
 	err = binary.Read(dec.reader, binary.BigEndian, &data)
 	if err != nil {
-		fmt.Printf("%v Read failed, err: %v\n", tag, err)
 		return 0, err
 	}
 	return data, err
 }
 
 func (dec *MessagePackDecoder) readUint32() (data uint32, err error) {
-	tag := "[MessagePackDecoder.readUint32]"
-
 	err = binary.Read(dec.reader, binary.BigEndian, &data)
 	if err != nil {
-		fmt.Printf("%v Read failed, err: %v\n", tag, err)
 		return 0, err
 	}
 	return data, err
 }
 
 func (dec *MessagePackDecoder) readUint64() (data uint64, err error) {
-	tag := "[MessagePackDecoder.readUint64]"
-
 	err = binary.Read(dec.reader, binary.BigEndian, &data)
 	if err != nil {
-		fmt.Printf("%v Read failed, err: %v\n", tag, err)
 		return 0, err
 	}
 	return data, err
@@ -2,7 +2,11 @@ package msgpack
 
 import (
 	"bytes"
+	"errors"
+	"io"
+	"reflect"
 	"testing"
+	"testing/iotest"
 )
 
 func TestPositiveFixInt(t *testing.T) {
@@ -311,6 +315,51 @@ func TestMap16(t *testing.T) {
 	}
 }
 
+func TestNonStringMapKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []byte
+		expected interface{}
+		wantErr  error
+	}{
+		{name: "int keys", input: []byte{0x82, 0x01, 0xA1, 'a', 0xD0, 0x80, 0xA1, 'b'}, expected: map[interface{}]interface{}{uint8(1): "a", int8(-128): "b"}},
+		{name: "bool key", input: []byte{0x81, 0xC2, 0xC0}, expected: map[interface{}]interface{}{false: nil}},
+		{name: "float key", input: []byte{0x81, 0xCA, 0x3F, 0xC0, 0x00, 0x00, 0x01}, expected: map[interface{}]interface{}{float32(1.5): uint8(1)}},
+		{name: "bin key", input: []byte{0x81, 0xC4, 0x01, 'k', 0x01}, expected: map[string]interface{}{"k": uint8(1)}},
+		{name: "string then int key", input: []byte{0x82, 0xA1, 'a', 0x01, 0x02, 0x03}, expected: map[interface{}]interface{}{"a": uint8(1), uint8(2): uint8(3)}},
+		{name: "array key", input: []byte{0x81, 0x90, 0x01}, wantErr: ErrUnsupportedType},
+		{name: "str then bin key", input: []byte{0x82, 0xA1, 'k', 0x01, 0xC4, 0x01, 'k', 0x02}, wantErr: ErrMapKeyCollision},
+		{name: "bin then str key", input: []byte{0x82, 0xC4, 0x01, 'k', 0x01, 0xA1, 'k', 0x02}, wantErr: ErrMapKeyCollision},
+		{name: "collision after int key", input: []byte{0x83, 0x01, 0x01, 0xA1, 'k', 0x01, 0xC4, 0x01, 'k', 0x02}, wantErr: ErrMapKeyCollision},
+		{name: "repeated bin key", input: []byte{0x82, 0xC4, 0x01, 'k', 0x01, 0xC4, 0x01, 'k', 0x02}, expected: map[string]interface{}{"k": uint8(2)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := NewMessagePackDecoder(tt.input).Decode()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("Decode() = %#v, want %#v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestUnmarshalMapKeyCollision(t *testing.T) {
+	input := []byte{0x82, 0xA1, 'k', 0x01, 0xC4, 0x01, 'k', 0x02}
+
+	targets := map[string]interface{}{
+		"string keys":    &map[string]int{},
+		"interface keys": &map[interface{}]interface{}{},
+	}
+	for name, target := range targets {
+		if err := Unmarshal(input, target); !errors.Is(err, ErrMapKeyCollision) {
+			t.Errorf("%s: Unmarshal() error = %v, wantErr %v", name, err, ErrMapKeyCollision)
+		}
+	}
+}
+
 func TestNegativeFixInt(t *testing.T) {
 	tests := []struct {
 		input    []byte
@@ -332,6 +381,50 @@ func TestNegativeFixInt(t *testing.T) {
 	}
 }
 
+func TestDecoderStream(t *testing.T) {
+	input := []byte{0x01, 0xA3, 'f', 'o', 'o', 0x92, 0xC3, 0xC0, 0xCD, 0x01, 0x00}
+	expected := []interface{}{uint8(1), "foo", []interface{}{true, nil}, uint16(256)}
+
+	decoder := NewDecoder(iotest.OneByteReader(bytes.NewReader(input)))
+	for _, want := range expected {
+		result, err := decoder.Decode()
+		if err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		if !isEqual(result, want) {
+			t.Errorf("Decode() = %v, want %v", result, want)
+		}
+	}
+
+	if _, err := decoder.Decode(); err != io.EOF {
+		t.Errorf("Decode() error = %v, want %v", err, io.EOF)
+	}
+}
+
+func TestDecoderTruncated(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+	}{
+		{name: "uint 16", input: []byte{0xCD, 0x01}},
+		{name: "float 64", input: []byte{0xCB}},
+		{name: "fixstr", input: []byte{0xA3, 'f', 'o'}},
+		{name: "str 8 length", input: []byte{0xD9}},
+		{name: "bin 8", input: []byte{0xC4, 0x02, 0x01}},
+		{name: "fixarray", input: []byte{0x92, 0x01}},
+		{name: "map 16 length", input: []byte{0xDE, 0x00}},
+		{name: "fixmap value", input: []byte{0x81, 0xA1, 'k'}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoder := NewDecoder(iotest.OneByteReader(bytes.NewReader(tt.input)))
+			if _, err := decoder.Decode(); !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Errorf("Decode() error = %v, want %v", err, io.ErrUnexpectedEOF)
+			}
+		})
+	}
+}
+
 // Helper function to compare expected and actual values
 func isEqual(a, b interface{}) bool {
 	switch a := a.(type) {
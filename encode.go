@@ -1,40 +1,111 @@
 package msgpack
 
 import (
-	"bytes"
 	"encoding/base64"
 	"encoding/binary"
-	"fmt"
+	"encoding/json"
+	"errors"
+	"io"
 	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func encode(buf *bytes.Buffer, data interface{}) error {
-	tag := "[encode]"
+// writer is the sink the encode functions write to. Both *bytes.Buffer and
+// *bufio.Writer satisfy it.
+type writer interface {
+	io.Writer
+	io.ByteWriter
+	io.StringWriter
+}
+
+// encodeState carries the settings of one encoder through the recursive
+// encode methods. The wire-level helpers below it stay plain functions.
+type encodeState struct {
+	buf  writer
+	opts EncoderOptions
+
+	// these are set by the JSON bridge only: string values under
+	// binaryKeyword are base64 and are written as bin, and numbers are
+	// written as the Options of the same names say
+	binaryKeyword    string
+	bigInt           BigIntFormat
+	numbers          NumberPolicy
+	float32Tolerance float64
+}
+
+func newEncodeState(buf writer, opts EncoderOptions) *encodeState {
+	return &encodeState{
+		buf:  buf,
+		opts: opts,
+	}
+}
+
+// encode, encodeArray and encodeMap encode with the default options.
+func encode(buf writer, data interface{}) error {
+	return newEncodeState(buf, EncoderOptions{}).encode(data)
+}
+
+func encodeArray(buf writer, value []interface{}) error {
+	return newEncodeState(buf, EncoderOptions{}).encodeArray(value)
+}
+
+func encodeMap(buf writer, value map[string]interface{}) error {
+	return newEncodeState(buf, EncoderOptions{}).encodeMap(value)
+}
+
+func (es *encodeState) encode(data interface{}) error {
+	buf := es.buf
+	es.traceType("encode", reflect.TypeOf(data))
 
 	switch v := data.(type) {
 	case bool:
 		return encodeBool(buf, v)
 
-	// JSON numbers are unmarshaled as float64, so we need to handle int and uint in this case.
+	case []byte:
+		return encodeBin(buf, v)
+
+	case Ext:
+		return encodeExt(buf, v.Type, v.Data)
+
+	case rawValue:
+		_, err := buf.Write(v)
+		return err
+
+	case json.Number:
+		return es.encodeJSONNumber(v)
+
 	case float64:
-		if float64(uint64(v)) == v {
-			return encodeUint(buf, uint64(v))
-		} else if float64(int64(v)) == v {
-			return encodeInt(buf, int64(v))
-		}
-		return encodeFloat(buf, v)
+		return es.encodeJSONFloat(v)
+
+	case float32:
+		return es.encodeFloat32(v)
 
 	case int:
-		return encodeInt(buf, int64(v))
+		return es.encodeInt64(int64(v))
+
+	case int8:
+		return es.encodeInt64(int64(v))
+
+	case int16:
+		return es.encodeInt64(int64(v))
+
+	case int32:
+		return es.encodeInt64(int64(v))
 
 	case int64:
-		return encodeInt(buf, v)
+		return es.encodeInt64(v)
 
 	case []interface{}:
-		return encodeArray(buf, v)
+		return es.encodeArray(v)
 
 	case map[string]interface{}:
-		return encodeMap(buf, v)
+		return es.encodeMap(v)
+
+	case map[interface{}]interface{}:
+		return es.encodeAnyMap(v)
 
 	case nil:
 		return encodeNil(buf, v)
@@ -45,53 +116,216 @@ func encode(buf *bytes.Buffer, data interface{}) error {
 	case uint:
 		return encodeUint(buf, uint64(v))
 
+	case uint8:
+		return encodeUint(buf, uint64(v))
+
+	case uint16:
+		return encodeUint(buf, uint64(v))
+
+	case uint32:
+		return encodeUint(buf, uint64(v))
+
 	case uint64:
 		return encodeUint(buf, v)
 
+	case uintptr:
+		return encodeUint(buf, uint64(v))
+
+	case time.Time:
+		return encodeTimestamp(buf, v)
+
 	default:
-		fmt.Printf("%v Unsupported Type: %T\n", tag, v)
+		if entry := es.lookupExtType(reflect.TypeOf(v)); entry != nil {
+			return es.encodeRegisteredExt(entry, v)
+		}
+
+		// named types whose underlying kind is numeric
+		switch value := reflect.ValueOf(v); value.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return es.encodeInt64(value.Int())
+
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return encodeUint(buf, value.Uint())
+
+		case reflect.Float32:
+			return es.encodeFloat32(float32(value.Float()))
+
+		case reflect.Float64:
+			return es.encodeFloat64(value.Float())
+		}
+
 		return ErrUnsupportedType
 	}
 }
 
-func encodeArray(buf *bytes.Buffer, value []interface{}) error {
-	tag := "[encodeArray]"
+// encodeJSONNumber writes a JSON number literal without going through
+// float64: unless es.numbers asks for float64 throughout, integer literals
+// become the smallest int or uint holding them exactly. Other literals are
+// written like encodeJSONFloat does.
+func (es *encodeState) encodeJSONNumber(n json.Number) error {
+	literal := string(n)
+
+	// -0 is left to encodeJSONFloat, which keeps its sign as NumbersSmallest
+	// asks
+	integer := !strings.ContainsAny(literal, ".eE") && !(es.numbers == NumbersSmallest && literal == "-0")
+	if es.numbers != NumbersFloat64 && integer {
+		var err error
+		if strings.HasPrefix(literal, "-") {
+			var i int64
+			if i, err = strconv.ParseInt(literal, 10, 64); err == nil {
+				return encodeInt(es.buf, i)
+			}
+		} else {
+			var u uint64
+			if u, err = strconv.ParseUint(literal, 10, 64); err == nil {
+				return encodeUint(es.buf, u)
+			}
+		}
 
-	length := len(value)
+		if errors.Is(err, strconv.ErrRange) {
+			return es.encodeBigInt(literal)
+		}
+		return ErrUnsupportedType
+	}
+
+	f, err := strconv.ParseFloat(literal, 64)
+	if err != nil {
+		if errors.Is(err, strconv.ErrRange) {
+			return ErrValueOutOfRange
+		}
+		return ErrUnsupportedType
+	}
+	return es.encodeJSONFloat(f)
+}
+
+// encodeJSONFloat writes a JSON number as es.numbers says. By default
+// integral values that fit 64 bits are written as integers, since JSON does
+// not tell 1 and 1.0 apart, and anything else as the smallest float within
+// es.float32Tolerance.
+func (es *encodeState) encodeJSONFloat(value float64) error {
+	switch es.numbers {
+	case NumbersFloat64:
+		return encodeFloat64(es.buf, value)
+
+	case NumbersSmallest:
+		// negative zero stays a float, keeping its sign
+		if value == math.Trunc(value) && (value != 0 || !math.Signbit(value)) {
+			switch {
+			case value >= 0 && value < math.Ldexp(1, 64):
+				return encodeUint(es.buf, uint64(value))
+			case value < 0 && value >= -math.Ldexp(1, 63):
+				return encodeInt(es.buf, int64(value))
+			}
+		}
+	}
 
+	if es.float32Tolerance > 0 {
+		narrowed := float64(float32(value))
+		if !math.IsInf(narrowed, 0) && math.Abs(narrowed-value) <= es.float32Tolerance*math.Abs(value) {
+			return encodeFloat32(es.buf, float32(value))
+		}
+	}
+	return es.encodeFloat64(value)
+}
+
+// encodeBigInt writes an integer literal beyond 64 bits as es.bigInt says.
+func (es *encodeState) encodeBigInt(literal string) error {
+	switch es.bigInt {
+	case BigIntFloat:
+		f, err := strconv.ParseFloat(literal, 64)
+		if err != nil {
+			return ErrValueOutOfRange
+		}
+		return es.encodeFloat64(f)
+
+	case BigIntString:
+		return encodeString(es.buf, literal)
+	}
+	return ErrValueOutOfRange
+}
+
+// encodeInt64 writes value as encodeInt does, except that canonical mode
+// uses the unsigned formats for non-negative values since they are never
+// longer.
+func (es *encodeState) encodeInt64(value int64) error {
+	if es.opts.Canonical && value >= 0 {
+		return encodeUint(es.buf, uint64(value))
+	}
+	return encodeInt(es.buf, value)
+}
+
+func (es *encodeState) encodeFloat32(value float32) error {
+	if es.opts.Canonical && math.IsNaN(float64(value)) {
+		return encodeFloat32(es.buf, math.Float32frombits(canonicalNaN))
+	}
+	return encodeFloat32(es.buf, value)
+}
+
+func (es *encodeState) encodeFloat64(value float64) error {
+	if es.opts.Canonical {
+		return encodeCanonicalFloat(es.buf, value)
+	}
+	return encodeFloat(es.buf, value)
+}
+
+func (es *encodeState) encodeArray(value []interface{}) error {
+	if err := encodeArrayHeader(es.buf, len(value)); err != nil {
+		return err
+	}
+
+	for _, element := range value {
+		if err := es.encode(element); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func encodeArrayHeader(buf writer, length int) (err error) {
 	switch {
+	case length < 0:
+		return ErrValueOutOfRange
+
 	// fixarray (0x90 ~ 0x9F)
 	case length <= 0xF:
-		buf.WriteByte(0x90 | byte(length))
+		err = buf.WriteByte(0x90 | byte(length))
+		if err != nil {
+			return err
+		}
 
 	// array 16 (0xDC)
 	case length <= 0xFFFF:
-		buf.WriteByte(0xDC)
-		binary.Write(buf, binary.BigEndian, int16(length))
+		err = buf.WriteByte(0xDC)
+		if err != nil {
+			return err
+		}
+
+		err = binary.Write(buf, binary.BigEndian, uint16(length))
+		if err != nil {
+			return err
+		}
 
 	// array 32 (0xDD)
 	case length <= 0xFFFFFFFF:
-		buf.WriteByte(0xDD)
-		binary.Write(buf, binary.BigEndian, int32(length))
-
-	default:
-		fmt.Printf("%v array size (%v) too large\n", tag, length)
-		return ErrArrayTooLong
-	}
+		err = buf.WriteByte(0xDD)
+		if err != nil {
+			return err
+		}
 
-	for _, element := range value {
-		if err := encode(buf, element); err != nil {
-			fmt.Printf("%v encode failed, err: %v\n", tag, err)
+		err = binary.Write(buf, binary.BigEndian, uint32(length))
+		if err != nil {
 			return err
 		}
+
+	default:
+		return ErrArrayTooLong
 	}
 
 	return nil
 }
 
-func encodeBinary(buf *bytes.Buffer, value interface{}) error {
-	tag := "[encodeBinary]"
-
+func encodeBinary(buf writer, value interface{}) error {
 	base64Str, ok := value.(string)
 	if !ok {
 		return ErrBinaryDataInvalid
@@ -99,10 +333,13 @@ func encodeBinary(buf *bytes.Buffer, value interface{}) error {
 
 	binData, err := base64.StdEncoding.DecodeString(base64Str)
 	if err != nil {
-		fmt.Printf("%v DecodeString failed, err: %v\n", tag, err)
 		return err
 	}
 
+	return encodeBin(buf, binData)
+}
+
+func encodeBin(buf writer, binData []byte) (err error) {
 	length := len(binData)
 
 	switch {
@@ -110,12 +347,10 @@ func encodeBinary(buf *bytes.Buffer, value interface{}) error {
 	case length <= 0xFF: // 2^8 - 1
 		err = buf.WriteByte(0xC4)
 		if err != nil {
-			fmt.Printf("%v WriteByte failed, err: %v\n", tag, err)
 			return err
 		}
-		err = binary.Write(buf, binary.BigEndian, int8(length))
+		err = binary.Write(buf, binary.BigEndian, uint8(length))
 		if err != nil {
-			fmt.Printf("%v Write failed, err: %v\n", tag, err)
 			return err
 		}
 
@@ -123,12 +358,10 @@ func encodeBinary(buf *bytes.Buffer, value interface{}) error {
 	case length <= 0xFFFF: // 2^16 - 1
 		err = buf.WriteByte(0xC5)
 		if err != nil {
-			fmt.Printf("%v WriteByte failed, err: %v\n", tag, err)
 			return err
 		}
-		err = binary.Write(buf, binary.BigEndian, int16(length))
+		err = binary.Write(buf, binary.BigEndian, uint16(length))
 		if err != nil {
-			fmt.Printf("%v Write failed, err: %v\n", tag, err)
 			return err
 		}
 
@@ -136,29 +369,25 @@ func encodeBinary(buf *bytes.Buffer, value interface{}) error {
 	case length <= 0xFFFFFFFF: // 2^32 - 1
 		err = buf.WriteByte(0xC6)
 		if err != nil {
-			fmt.Printf("%v WriteByte failed, err: %v\n", tag, err)
 			return err
 		}
-		err = binary.Write(buf, binary.BigEndian, int32(length))
+		err = binary.Write(buf, binary.BigEndian, uint32(length))
 		if err != nil {
-			fmt.Printf("%v Write failed, err: %v\n", tag, err)
 			return err
 		}
 
 	default:
-		fmt.Printf("%v bin size (%v) too large\n", tag, length)
 		return ErrBinaryTooLong
 	}
 
 	_, err = buf.Write(binData)
 	if err != nil {
-		fmt.Printf("%v Write failed, err: %v\n", tag, err)
 		return err
 	}
 	return nil
 }
 
-func encodeBool(buf *bytes.Buffer, value bool) error {
+func encodeBool(buf writer, value bool) error {
 	// false (0xC2)
 	if !value {
 		return buf.WriteByte(0xC2)
@@ -167,52 +396,126 @@ func encodeBool(buf *bytes.Buffer, value bool) error {
 	return buf.WriteByte(0xC3)
 }
 
-func encodeFloat(buf *bytes.Buffer, value float64) error {
-	tag := "[encodeFloat]"
+func encodeExt(buf writer, extType int8, data []byte) (err error) {
+	length := len(data)
 
-	if float64(float32(value)) == value {
-		// float 32 (0xCA)
-		err := buf.WriteByte(0xCA)
-		if err != nil {
-			fmt.Printf("%v WriteByte failed, err: %v\n", tag, err)
-			return err
-		}
+	switch {
+	// fixext 1 (0xD4)
+	case length == 1:
+		err = buf.WriteByte(0xD4)
+
+	// fixext 2 (0xD5)
+	case length == 2:
+		err = buf.WriteByte(0xD5)
+
+	// fixext 4 (0xD6)
+	case length == 4:
+		err = buf.WriteByte(0xD6)
+
+	// fixext 8 (0xD7)
+	case length == 8:
+		err = buf.WriteByte(0xD7)
 
-		bits := math.Float32bits(float32(value))
+	// fixext 16 (0xD8)
+	case length == 16:
+		err = buf.WriteByte(0xD8)
 
-		err = binary.Write(buf, binary.BigEndian, bits)
+	// ext 8 (0xC7)
+	case length <= 0xFF: // 2^8 - 1
+		err = buf.WriteByte(0xC7)
 		if err != nil {
-			fmt.Printf("%v Write failed, err: %v\n", tag, err)
 			return err
 		}
-	} else {
-		// float 64 (0xCB)
-		err := buf.WriteByte(0xCB)
+
+		err = buf.WriteByte(byte(length))
+
+	// ext 16 (0xC8)
+	case length <= 0xFFFF: // 2^16 - 1
+		err = buf.WriteByte(0xC8)
 		if err != nil {
-			fmt.Printf("%v WriteByte failed, err: %v\n", tag, err)
 			return err
 		}
 
-		bits := math.Float64bits(value)
+		err = binary.Write(buf, binary.BigEndian, uint16(length))
 
-		err = binary.Write(buf, binary.BigEndian, bits)
+	// ext 32 (0xC9)
+	case length <= 0xFFFFFFFF: // 2^32 - 1
+		err = buf.WriteByte(0xC9)
 		if err != nil {
-			fmt.Printf("%v Write failed, err: %v\n", tag, err)
 			return err
 		}
+
+		err = binary.Write(buf, binary.BigEndian, uint32(length))
+
+	default:
+		return ErrExtTooLong
+	}
+	if err != nil {
+		return err
+	}
+
+	err = buf.WriteByte(byte(extType))
+	if err != nil {
+		return err
+	}
+
+	_, err = buf.Write(data)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func encodeFloat(buf writer, value float64) error {
+	if float64(float32(value)) == value {
+		return encodeFloat32(buf, float32(value))
 	}
+
+	return encodeFloat64(buf, value)
+}
+
+// encodeFloat64 always uses float 64, where encodeFloat would narrow.
+func encodeFloat64(buf writer, value float64) error {
+	// float 64 (0xCB)
+	err := buf.WriteByte(0xCB)
+	if err != nil {
+		return err
+	}
+
+	bits := math.Float64bits(value)
+
+	err = binary.Write(buf, binary.BigEndian, bits)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
-func encodeInt(buf *bytes.Buffer, value int64) (err error) {
-	tag := "[encodeInt]"
+func encodeFloat32(buf writer, value float32) error {
+	// float 32 (0xCA)
+	err := buf.WriteByte(0xCA)
+	if err != nil {
+		return err
+	}
+
+	bits := math.Float32bits(value)
+
+	err = binary.Write(buf, binary.BigEndian, bits)
+	if err != nil {
+		return err
+	}
 
+	return nil
+}
+
+func encodeInt(buf writer, value int64) (err error) {
 	switch {
 	// positive fixint (0x00 ~ 0x7F)
 	case value >= 0 && value <= 0x7F:
 		err = buf.WriteByte(byte(value))
 		if err != nil {
-			fmt.Printf("%v WriteByte failed, err: %v\n", tag, err)
 			return err
 		}
 
@@ -220,7 +523,6 @@ func encodeInt(buf *bytes.Buffer, value int64) (err error) {
 	case value >= -32 && value <= -1:
 		err = buf.WriteByte(0xE0 | byte(value+32))
 		if err != nil {
-			fmt.Printf("%v WriteByte failed, err: %v\n", tag, err)
 			return err
 		}
 
@@ -228,13 +530,11 @@ func encodeInt(buf *bytes.Buffer, value int64) (err error) {
 	case value >= -128 && value <= 127:
 		err = buf.WriteByte(0xD0)
 		if err != nil {
-			fmt.Printf("%v WriteByte failed, err: %v\n", tag, err)
 			return err
 		}
 
 		err = buf.WriteByte(byte(value))
 		if err != nil {
-			fmt.Printf("%v WriteByte failed, err: %v\n", tag, err)
 			return err
 		}
 
@@ -242,13 +542,11 @@ func encodeInt(buf *bytes.Buffer, value int64) (err error) {
 	case value >= -32768 && value <= 32767:
 		err = buf.WriteByte(0xD1)
 		if err != nil {
-			fmt.Printf("%v WriteByte failed, err: %v\n", tag, err)
 			return err
 		}
 
 		err = binary.Write(buf, binary.BigEndian, int16(value))
 		if err != nil {
-			fmt.Printf("%v Write failed, err: %v\n", tag, err)
 			return err
 		}
 
@@ -256,13 +554,11 @@ func encodeInt(buf *bytes.Buffer, value int64) (err error) {
 	case value >= -2147483648 && value <= 2147483647:
 		err = buf.WriteByte(0xD2)
 		if err != nil {
-			fmt.Printf("%v WriteByte failed, err: %v\n", tag, err)
 			return err
 		}
 
 		err = binary.Write(buf, binary.BigEndian, int32(value))
 		if err != nil {
-			fmt.Printf("%v Write failed, err: %v\n", tag, err)
 			return err
 		}
 
@@ -270,35 +566,106 @@ func encodeInt(buf *bytes.Buffer, value int64) (err error) {
 	case value >= -9223372036854775808 && value <= 9223372036854775807:
 		err = buf.WriteByte(0xD3)
 		if err != nil {
-			fmt.Printf("%v WriteByte failed, err: %v\n", tag, err)
 			return err
 		}
 
 		err = binary.Write(buf, binary.BigEndian, value)
 		if err != nil {
-			fmt.Printf("%v Write failed, err: %v\n", tag, err)
 			return err
 		}
 
 	default:
-		fmt.Printf("%v not supported value(%v)\n", tag, value)
 		return ErrValueOutOfRange
 	}
 
 	return nil
 }
 
-func encodeMap(buf *bytes.Buffer, value map[string]interface{}) (err error) {
-	tag := "[encodeMap]"
+func (es *encodeState) encodeMap(value map[string]interface{}) (err error) {
+	if err := encodeMapHeader(es.buf, len(value)); err != nil {
+		return err
+	}
 
-	length := len(value)
+	keys := make([]string, 0, len(value))
+	for key := range value {
+		keys = append(keys, key)
+	}
+	if es.opts.Canonical {
+		sortCanonicalStrings(keys)
+	}
+
+	for _, key := range keys {
+		val := value[key]
+
+		if err := encodeString(es.buf, key); err != nil {
+			return err
+		}
 
+		if es.binaryKeyword != "" && key == es.binaryKeyword && !isMappedValue(val) {
+			if err := encodeBinary(es.buf, val); err != nil {
+				return err
+			}
+		} else {
+			if err := es.encode(val); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// encodeAnyMap encodes maps whose keys need not be strings, such as those
+// the decoder returns for integer keys.
+func (es *encodeState) encodeAnyMap(value map[interface{}]interface{}) error {
+	if err := encodeMapHeader(es.buf, len(value)); err != nil {
+		return err
+	}
+
+	keys := make([]interface{}, 0, len(value))
+	for key := range value {
+		keys = append(keys, key)
+	}
+
+	if !es.opts.Canonical {
+		for _, key := range keys {
+			if err := es.encode(key); err != nil {
+				return err
+			}
+			if err := es.encode(value[key]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	encodedKeys, order, err := es.sortEncodedKeys(len(keys), func(kes *encodeState, i int) error {
+		return kes.encode(keys[i])
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, i := range order {
+		if _, err := es.buf.Write(encodedKeys[i]); err != nil {
+			return err
+		}
+		if err := es.encode(value[keys[i]]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func encodeMapHeader(buf writer, length int) (err error) {
 	switch {
+	case length < 0:
+		return ErrValueOutOfRange
+
 	//fixmap (0x80 ~ 0x8F)
 	case length <= 0xF:
 		err = buf.WriteByte(0x80 | byte(length))
 		if err != nil {
-			fmt.Printf("%v WriteByte failed, err: %v\n", tag, err)
 			return err
 		}
 
@@ -306,13 +673,11 @@ func encodeMap(buf *bytes.Buffer, value map[string]interface{}) (err error) {
 	case length <= 0xFFFF:
 		err = buf.WriteByte(0xDE)
 		if err != nil {
-			fmt.Printf("%v WriteByte failed, err: %v\n", tag, err)
 			return err
 		}
 
-		err = binary.Write(buf, binary.BigEndian, int16(length))
+		err = binary.Write(buf, binary.BigEndian, uint16(length))
 		if err != nil {
-			fmt.Printf("%v Write failed, err: %v\n", tag, err)
 			return err
 		}
 
@@ -320,49 +685,26 @@ func encodeMap(buf *bytes.Buffer, value map[string]interface{}) (err error) {
 	case length <= 0xFFFFFFFF:
 		err = buf.WriteByte(0xDF)
 		if err != nil {
-			fmt.Printf("%v WriteByte failed, err: %v\n", tag, err)
 			return err
 		}
 
-		err = binary.Write(buf, binary.BigEndian, int32(length))
+		err = binary.Write(buf, binary.BigEndian, uint32(length))
 		if err != nil {
-			fmt.Printf("%v Write failed, err: %v\n", tag, err)
 			return err
 		}
 
 	default:
-		fmt.Printf("%v map size(%v) too large\n", tag, length)
 		return ErrValueOutOfRange
 	}
 
-	for key, val := range value {
-		if err := encodeString(buf, key); err != nil {
-			fmt.Printf("%v key encodeString failed, err: %v\n", tag, err)
-			return err
-		}
-
-		if key == binaryKeyword {
-			if err := encodeBinary(buf, val); err != nil {
-				fmt.Printf("%v encodeBinary failed, err: %v\n", tag, err)
-				return err
-			}
-		} else {
-			if err := encode(buf, val); err != nil {
-				fmt.Printf("%v value encode failed, err: %v\n", tag, err)
-				return err
-			}
-		}
-	}
 	return nil
 }
 
-func encodeNil(buf *bytes.Buffer, _ interface{}) error {
+func encodeNil(buf writer, _ interface{}) error {
 	return buf.WriteByte(0xC0)
 }
 
-func encodeString(buf *bytes.Buffer, value string) (err error) {
-	tag := "[encodeString]"
-
+func encodeString(buf writer, value string) (err error) {
 	length := len(value)
 
 	switch {
@@ -370,7 +712,6 @@ func encodeString(buf *bytes.Buffer, value string) (err error) {
 	case length <= 0x1F: // 31
 		err = buf.WriteByte(0xA0 | byte(length))
 		if err != nil {
-			fmt.Printf("%v WriteByte failed, err: %v\n", tag, err)
 			return err
 		}
 
@@ -378,13 +719,11 @@ func encodeString(buf *bytes.Buffer, value string) (err error) {
 	case length <= 0xFF: // 2^8 - 1
 		err = buf.WriteByte(0xD9)
 		if err != nil {
-			fmt.Printf("%v WriteByte failed, err: %v\n", tag, err)
 			return err
 		}
 
 		err = buf.WriteByte(byte(length))
 		if err != nil {
-			fmt.Printf("%v WriteByte failed, err: %v\n", tag, err)
 			return err
 		}
 
@@ -392,13 +731,11 @@ func encodeString(buf *bytes.Buffer, value string) (err error) {
 	case length <= 0xFFFF: // 2^16 - 1
 		err = buf.WriteByte(0xDA)
 		if err != nil {
-			fmt.Printf("%v WriteByte failed, err: %v\n", tag, err)
 			return err
 		}
 
 		_, err = buf.Write([]byte{byte(length >> 8), byte(length)})
 		if err != nil {
-			fmt.Printf("%v Write failed, err: %v\n", tag, err)
 			return err
 		}
 
@@ -406,40 +743,33 @@ func encodeString(buf *bytes.Buffer, value string) (err error) {
 	case length <= 0xFFFFFFFF: // 2^32 - 1
 		err = buf.WriteByte(0xDB)
 		if err != nil {
-			fmt.Printf("%v WriteByte failed, err: %v\n", tag, err)
 			return err
 		}
 
 		_, err = buf.Write([]byte{byte(length >> 24), byte(length >> 16), byte(length >> 8), byte(length)})
 		if err != nil {
-			fmt.Printf("%v Write failed, err: %v\n", tag, err)
 			return err
 		}
 
 	default:
-		fmt.Printf("%v string size(%v) too large\n", tag, length)
 		return ErrStringTooLong
 	}
 
 	// write string content to buffer
 	_, err = buf.WriteString(value)
 	if err != nil {
-		fmt.Printf("%v WriteString failed, err: %v\n", tag, err)
 		return err
 	}
 
 	return nil
 }
 
-func encodeUint(buf *bytes.Buffer, value uint64) (err error) {
-	tag := "[encodeUint]"
-
+func encodeUint(buf writer, value uint64) (err error) {
 	switch {
 	// positive fixint (0x00 ~ 0x7F)
 	case value >= 0 && value <= 0x7F:
 		err = buf.WriteByte(byte(value))
 		if err != nil {
-			fmt.Printf("%v WriteByte failed, err: %v\n", tag, err)
 			return err
 		}
 
@@ -447,13 +777,11 @@ func encodeUint(buf *bytes.Buffer, value uint64) (err error) {
 	case value <= 0xFF:
 		err = buf.WriteByte(0xCC)
 		if err != nil {
-			fmt.Printf("%v WriteByte failed, err: %v\n", tag, err)
 			return err
 		}
 
 		err = buf.WriteByte(byte(value))
 		if err != nil {
-			fmt.Printf("%v WriteByte failed, err: %v\n", tag, err)
 			return err
 		}
 
@@ -461,13 +789,11 @@ func encodeUint(buf *bytes.Buffer, value uint64) (err error) {
 	case value <= 0xFFFF:
 		err = buf.WriteByte(0xCD)
 		if err != nil {
-			fmt.Printf("%v WriteByte failed, err: %v\n", tag, err)
 			return err
 		}
 
 		err = binary.Write(buf, binary.BigEndian, uint16(value))
 		if err != nil {
-			fmt.Printf("%v Write failed, err: %v\n", tag, err)
 			return err
 		}
 
@@ -475,13 +801,11 @@ func encodeUint(buf *bytes.Buffer, value uint64) (err error) {
 	case value <= 0xFFFFFFFF:
 		err = buf.WriteByte(0xCE)
 		if err != nil {
-			fmt.Printf("%v WriteByte failed, err: %v\n", tag, err)
 			return err
 		}
 
 		err = binary.Write(buf, binary.BigEndian, uint32(value))
 		if err != nil {
-			fmt.Printf("%v Write failed, err: %v\n", tag, err)
 			return err
 		}
 
@@ -489,18 +813,15 @@ func encodeUint(buf *bytes.Buffer, value uint64) (err error) {
 	case value <= 0xFFFFFFFFFFFFFFFF:
 		err = buf.WriteByte(0xCF)
 		if err != nil {
-			fmt.Printf("%v WriteByte failed, err: %v\n", tag, err)
 			return err
 		}
 
 		err = binary.Write(buf, binary.BigEndian, value)
 		if err != nil {
-			fmt.Printf("%v Write failed, err: %v\n", tag, err)
 			return err
 		}
 
 	default:
-		fmt.Printf("%v not supported value(%v)\n", tag, value)
 		return ErrValueOutOfRange
 	}
 
@@ -2,6 +2,8 @@ package msgpack
 
 import (
 	"bytes"
+	"encoding/json"
+	"math"
 	"strconv"
 	"strings"
 	"testing"
@@ -36,6 +38,49 @@ func Test_encode(t *testing.T) {
 	}
 }
 
+func Test_encodeNumericWidths(t *testing.T) {
+	var buf bytes.Buffer
+
+	type celsius float32
+	type port uint16
+	type offset int8
+
+	tests := []struct {
+		name    string
+		arg     interface{}
+		encoded []byte
+	}{
+		{name: "int8", arg: int8(-100), encoded: []byte{0xD0, 0x9C}},
+		{name: "int16", arg: int16(-1000), encoded: []byte{0xD1, 0xFC, 0x18}},
+		{name: "int32", arg: int32(-100000), encoded: []byte{0xD2, 0xFF, 0xFE, 0x79, 0x60}},
+		{name: "uint8", arg: uint8(200), encoded: []byte{0xCC, 0xC8}},
+		{name: "uint16", arg: uint16(1000), encoded: []byte{0xCD, 0x03, 0xE8}},
+		{name: "uint32", arg: uint32(100000), encoded: []byte{0xCE, 0x00, 0x01, 0x86, 0xA0}},
+		{name: "uintptr", arg: uintptr(1), encoded: []byte{0x01}},
+		{name: "small values stay fixint", arg: int32(5), encoded: []byte{0x05}},
+		{name: "float32", arg: float32(1.1), encoded: []byte{0xCA, 0x3F, 0x8C, 0xCC, 0xCD}},
+		{name: "named float32", arg: celsius(1.5), encoded: []byte{0xCA, 0x3F, 0xC0, 0x00, 0x00}},
+		{name: "named uint16", arg: port(8080), encoded: []byte{0xCD, 0x1F, 0x90}},
+		{name: "named int8", arg: offset(-1), encoded: []byte{0xFF}},
+		{name: "integral float64", arg: float64(-1), encoded: []byte{0xFF}},
+		{name: "float64 beyond uint64", arg: math.Ldexp(1, 64), encoded: []byte{0xCA, 0x5F, 0x80, 0x00, 0x00}},
+		{name: "json.Number uint64", arg: json.Number("18446744073709551615"), encoded: []byte{0xCF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}},
+		{name: "json.Number float", arg: json.Number("1.5"), encoded: []byte{0xCA, 0x3F, 0xC0, 0x00, 0x00}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+
+			if err := encode(&buf, tt.arg); err != nil {
+				t.Fatalf("encode() error = %v", err)
+			}
+			if !bytes.Equal(buf.Bytes(), tt.encoded) {
+				t.Errorf("encoded not match, want: % X, got: % X\n", tt.encoded, buf.Bytes())
+			}
+		})
+	}
+}
+
 func Test_encodeBool(t *testing.T) {
 	var buf bytes.Buffer
 
@@ -151,6 +196,36 @@ func Test_encodeFloat(t *testing.T) {
 	}
 }
 
+func Test_encodeBin(t *testing.T) {
+	var buf bytes.Buffer
+
+	tests := []struct {
+		name          string
+		value         []byte
+		encodedPrefix []byte
+	}{
+		{name: "bin 8, size 0", value: []byte{}, encodedPrefix: []byte{0xC4, 0x00}},
+		{name: "bin 8, size 255", value: make([]byte, 255), encodedPrefix: []byte{0xC4, 0xFF}},
+		{name: "bin 16, size 256", value: make([]byte, 256), encodedPrefix: []byte{0xC5, 0x01, 0x00}},
+		{name: "bin 32, size 65536", value: make([]byte, 65536), encodedPrefix: []byte{0xC6, 0x00, 0x01, 0x00, 0x00}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+
+			if err := encode(&buf, tt.value); err != nil {
+				t.Fatalf("encode() error = %v", err)
+			}
+			if !bytes.HasPrefix(buf.Bytes(), tt.encodedPrefix) {
+				t.Errorf("encoded prefix not match, want: % X, got: % X\n", tt.encodedPrefix, buf.Bytes()[:len(tt.encodedPrefix)])
+			}
+			if buf.Len() != len(tt.encodedPrefix)+len(tt.value) {
+				t.Errorf("encoded size = %v, want %v", buf.Len(), len(tt.encodedPrefix)+len(tt.value))
+			}
+		})
+	}
+}
+
 func Test_encodeArray(t *testing.T) {
 	var buf bytes.Buffer
 
@@ -0,0 +1,112 @@
+package msgpack
+
+import (
+	"bufio"
+	"io"
+	"log/slog"
+	"reflect"
+)
+
+// EncoderOptions configures an Encoder. The zero value encodes like Marshal.
+type EncoderOptions struct {
+	// ExtRegistry maps Go types to extension types, overriding the types
+	// registered with RegisterExt; types it does not define fall back to
+	// those. Nil uses the registered types alone.
+	ExtRegistry *ExtRegistry
+
+	// Canonical makes the output deterministic: map keys and struct fields
+	// are sorted, non-negative integers use the unsigned formats, floats use
+	// float 32 when that is lossless and NaN is written as a single quiet
+	// NaN. The result matches what Canonicalize produces.
+	Canonical bool
+
+	// Logger receives debug traces of the Go types being encoded and of
+	// the choices the options make. Nil keeps the encoder silent.
+	Logger *slog.Logger
+}
+
+// Encoder writes MessagePack values to an output stream.
+type Encoder struct {
+	dst *errWriter
+	w   *bufio.Writer
+	es  *encodeState
+
+	// check encodes each value into nothing first, so a value that cannot
+	// be encoded is found before any of it is written
+	check *encodeState
+}
+
+// errWriter remembers the first error of the writer it wraps.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) Write(p []byte) (int, error) {
+	n, err := ew.w.Write(p)
+	if err != nil && ew.err == nil {
+		ew.err = err
+	}
+	return n, err
+}
+
+// discardWriter drops everything written to it.
+type discardWriter struct{}
+
+func (discardWriter) Write(p []byte) (int, error)       { return len(p), nil }
+func (discardWriter) WriteByte(byte) error              { return nil }
+func (discardWriter) WriteString(s string) (int, error) { return len(s), nil }
+
+// NewEncoder returns an encoder that writes to w through a buffer.
+func NewEncoder(w io.Writer) *Encoder {
+	return NewEncoderWithOptions(w, EncoderOptions{})
+}
+
+// NewEncoderWithOptions is like NewEncoder but configured by opts.
+func NewEncoderWithOptions(w io.Writer, opts EncoderOptions) *Encoder {
+	dst := &errWriter{w: w}
+	bw := bufio.NewWriter(dst)
+
+	// the check pass stays silent so each value is traced once
+	checkOpts := opts
+	checkOpts.Logger = nil
+
+	return &Encoder{
+		dst:   dst,
+		w:     bw,
+		es:    newEncodeState(bw, opts),
+		check: newEncodeState(discardWriter{}, checkOpts),
+	}
+}
+
+// Encode writes the MessagePack encoding of v to the stream and flushes it,
+// so values can be written back-to-back. v is encoded as by Marshal. The
+// value is streamed through a fixed-size buffer rather than held in memory
+// whole; it is encoded once without output beforehand, so a value that
+// cannot be encoded is dropped as a whole and nothing of it reaches the
+// stream.
+//
+// Errors from the underlying writer are returned as is; once one occurs,
+// every later call returns it too.
+func (e *Encoder) Encode(v interface{}) error {
+	if e.dst.err != nil {
+		return e.dst.err
+	}
+
+	value := reflect.ValueOf(v)
+	if err := e.check.encodeValue(value); err != nil {
+		e.es.traceError("encode failed", err)
+		return err
+	}
+
+	if err := e.es.encodeValue(value); err != nil {
+		e.es.traceError("encode failed", err)
+		// drop what is still buffered, but keep write errors sticky
+		if e.dst.err == nil {
+			e.w.Reset(e.dst)
+		}
+		return err
+	}
+
+	return e.w.Flush()
+}
@@ -0,0 +1,112 @@
+package msgpack
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type failingWriter struct {
+	err error
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	return 0, w.err
+}
+
+func TestEncoderEncode(t *testing.T) {
+	var out bytes.Buffer
+	enc := NewEncoder(&out)
+
+	values := []interface{}{1, "a", []bool{true}, testPoint{X: 1}}
+	for _, v := range values {
+		if err := enc.Encode(v); err != nil {
+			t.Fatalf("Encode(%v) error = %v", v, err)
+		}
+	}
+
+	expected := []byte{0x01, 0xA1, 'a', 0x91, 0xC3, 0x81, 0xA1, 'x', 0x01}
+	if !bytes.Equal(out.Bytes(), expected) {
+		t.Errorf("Encode() wrote % X, want % X", out.Bytes(), expected)
+	}
+}
+
+func TestEncoderDropsFailedValue(t *testing.T) {
+	var out bytes.Buffer
+	enc := NewEncoder(&out)
+
+	if err := enc.Encode([]interface{}{1, make(chan int)}); err != ErrUnsupportedType {
+		t.Fatalf("Encode() error = %v, wantErr %v", err, ErrUnsupportedType)
+	}
+	if err := enc.Encode(2); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	if !bytes.Equal(out.Bytes(), []byte{0x02}) {
+		t.Errorf("Encode() wrote % X, want 02", out.Bytes())
+	}
+}
+
+func TestEncoderDropsLargeFailedValue(t *testing.T) {
+	var out bytes.Buffer
+	enc := NewEncoder(&out)
+
+	// larger than any write buffer, so a partial value would reach out
+	value := []interface{}{strings.Repeat("a", 5000), func() {}}
+	if err := enc.Encode(value); err != ErrUnsupportedType {
+		t.Fatalf("Encode() error = %v, wantErr %v", err, ErrUnsupportedType)
+	}
+	if out.Len() != 0 {
+		t.Fatalf("Encode() wrote %d bytes of a failed value", out.Len())
+	}
+
+	if err := enc.Encode(1); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if v, err := NewMessagePackDecoder(out.Bytes()).Decode(); err != nil || v != uint8(1) {
+		t.Errorf("Decode() = %v, %v, want 1", v, err)
+	}
+}
+
+// countingWriter records the size of each write.
+type countingWriter struct {
+	writes []int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, len(p))
+	return len(p), nil
+}
+
+func TestEncoderStreamsLargeValue(t *testing.T) {
+	var out countingWriter
+	enc := NewEncoder(&out)
+
+	if err := enc.Encode(strings.Repeat("a", 20000)); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	total := 0
+	for _, n := range out.writes {
+		if n > 4096 {
+			t.Errorf("Encode() wrote %d bytes at once, want the value streamed", n)
+		}
+		total += n
+	}
+	if total != 20003 {
+		t.Errorf("Encode() wrote %d bytes, want 20003", total)
+	}
+}
+
+func TestEncoderWriteError(t *testing.T) {
+	writeErr := errors.New("connection reset")
+	enc := NewEncoder(&failingWriter{err: writeErr})
+
+	if err := enc.Encode("value"); err != writeErr {
+		t.Fatalf("Encode() error = %v, wantErr %v", err, writeErr)
+	}
+	if err := enc.Encode(1); err != writeErr {
+		t.Errorf("second Encode() error = %v, wantErr %v", err, writeErr)
+	}
+}
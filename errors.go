@@ -1,5 +1,13 @@
 package msgpack
 
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
 type ErrorType struct {
 	ErrCode uint16
 	ErrStr  string
@@ -15,32 +23,181 @@ const (
 	ErrCodeArrayTooLong
 	ErrCodeReadByte
 	ErrCodeLengthInvalid
+	ErrCodeInvalidUnmarshal
+	ErrCodeExtTooLong
+	ErrCodeTimestampInvalid
+	ErrCodeTrailingData
+	ErrCodeMaxDepthExceeded
+	ErrCodeMaxContainerLenExceeded
+	ErrCodeMaxStringLenExceeded
+	ErrCodeMaxBinLenExceeded
+	ErrCodeMaxAllocExceeded
+	ErrCodeLengthExceedsInput
+	ErrCodeMappingInvalid
+	ErrCodeFloatNotFinite
+	ErrCodeTypedJSONInvalid
+	ErrCodeTypeMismatch
+	ErrCodeEndOfContainer
+	ErrCodeMapKeyCollision
+	ErrCodeSkipSubtree
+	ErrCodeStopWalk
+	ErrCodeUnsettableEmbedded
 )
 
 const (
-	ErrStrUnsupportedType   = "UnsupportedType"
-	ErrStrStringTooLong     = "StringTooLong"
-	ErrStrValueOutOfRange   = "ValueOutOfRange"
-	ErrStrBinaryTooLong     = "BinaryTooLong"
-	ErrStrBinaryDataInvalid = "BinaryDataInvalid"
-	ErrStrInitConstants     = "InitConstants"
-	ErrStrArrayTooLong      = "ArrayTooLong"
-	ErrStrReadByte          = "ReadByte"
-	ErrStrLengthInvalid     = "LengthInvalid"
+	ErrStrUnsupportedType         = "UnsupportedType"
+	ErrStrStringTooLong           = "StringTooLong"
+	ErrStrValueOutOfRange         = "ValueOutOfRange"
+	ErrStrBinaryTooLong           = "BinaryTooLong"
+	ErrStrBinaryDataInvalid       = "BinaryDataInvalid"
+	ErrStrInitConstants           = "InitConstants"
+	ErrStrArrayTooLong            = "ArrayTooLong"
+	ErrStrReadByte                = "ReadByte"
+	ErrStrLengthInvalid           = "LengthInvalid"
+	ErrStrInvalidUnmarshal        = "InvalidUnmarshal"
+	ErrStrExtTooLong              = "ExtTooLong"
+	ErrStrTimestampInvalid        = "TimestampInvalid"
+	ErrStrTrailingData            = "TrailingData"
+	ErrStrMaxDepthExceeded        = "MaxDepthExceeded"
+	ErrStrMaxContainerLenExceeded = "MaxContainerLenExceeded"
+	ErrStrMaxStringLenExceeded    = "MaxStringLenExceeded"
+	ErrStrMaxBinLenExceeded       = "MaxBinLenExceeded"
+	ErrStrMaxAllocExceeded        = "MaxAllocExceeded"
+	ErrStrLengthExceedsInput      = "LengthExceedsInput"
+	ErrStrMappingInvalid          = "MappingInvalid"
+	ErrStrFloatNotFinite          = "FloatNotFinite"
+	ErrStrTypedJSONInvalid        = "TypedJSONInvalid"
+	ErrStrTypeMismatch            = "TypeMismatch"
+	ErrStrEndOfContainer          = "EndOfContainer"
+	ErrStrMapKeyCollision         = "MapKeyCollision"
+	ErrStrSkipSubtree             = "SkipSubtree"
+	ErrStrStopWalk                = "StopWalk"
+	ErrStrUnsettableEmbedded      = "UnsettableEmbedded"
+)
+
+var (
+	ErrUnsupportedType         = ErrorType{ErrCode: ErrCodeUnsupportedType, ErrStr: ErrStrUnsupportedType}
+	ErrStringTooLong           = ErrorType{ErrCode: ErrCodeStringTooLong, ErrStr: ErrStrStringTooLong}
+	ErrValueOutOfRange         = ErrorType{ErrCode: ErrCodeValueOutOfRange, ErrStr: ErrStrValueOutOfRange}
+	ErrBinaryTooLong           = ErrorType{ErrCode: ErrCodeBinaryTooLong, ErrStr: ErrStrBinaryTooLong}
+	ErrBinaryDataInvalid       = ErrorType{ErrCode: ErrCodeBinaryDataInvalid, ErrStr: ErrStrBinaryDataInvalid}
+	ErrInitConstants           = ErrorType{ErrCode: ErrCodeInitConstants, ErrStr: ErrStrInitConstants}
+	ErrArrayTooLong            = ErrorType{ErrCode: ErrCodeArrayTooLong, ErrStr: ErrStrArrayTooLong}
+	ErrReadByte                = ErrorType{ErrCode: ErrCodeReadByte, ErrStr: ErrStrReadByte}
+	ErrLengthInvalid           = ErrorType{ErrCode: ErrCodeLengthInvalid, ErrStr: ErrStrLengthInvalid}
+	ErrInvalidUnmarshal        = ErrorType{ErrCode: ErrCodeInvalidUnmarshal, ErrStr: ErrStrInvalidUnmarshal}
+	ErrExtTooLong              = ErrorType{ErrCode: ErrCodeExtTooLong, ErrStr: ErrStrExtTooLong}
+	ErrTimestampInvalid        = ErrorType{ErrCode: ErrCodeTimestampInvalid, ErrStr: ErrStrTimestampInvalid}
+	ErrTrailingData            = ErrorType{ErrCode: ErrCodeTrailingData, ErrStr: ErrStrTrailingData}
+	ErrMaxDepthExceeded        = ErrorType{ErrCode: ErrCodeMaxDepthExceeded, ErrStr: ErrStrMaxDepthExceeded}
+	ErrMaxContainerLenExceeded = ErrorType{ErrCode: ErrCodeMaxContainerLenExceeded, ErrStr: ErrStrMaxContainerLenExceeded}
+	ErrMaxStringLenExceeded    = ErrorType{ErrCode: ErrCodeMaxStringLenExceeded, ErrStr: ErrStrMaxStringLenExceeded}
+	ErrMaxBinLenExceeded       = ErrorType{ErrCode: ErrCodeMaxBinLenExceeded, ErrStr: ErrStrMaxBinLenExceeded}
+	ErrMaxAllocExceeded        = ErrorType{ErrCode: ErrCodeMaxAllocExceeded, ErrStr: ErrStrMaxAllocExceeded}
+	ErrLengthExceedsInput      = ErrorType{ErrCode: ErrCodeLengthExceedsInput, ErrStr: ErrStrLengthExceedsInput}
+	ErrMappingInvalid          = ErrorType{ErrCode: ErrCodeMappingInvalid, ErrStr: ErrStrMappingInvalid}
+	ErrFloatNotFinite          = ErrorType{ErrCode: ErrCodeFloatNotFinite, ErrStr: ErrStrFloatNotFinite}
+	ErrTypedJSONInvalid        = ErrorType{ErrCode: ErrCodeTypedJSONInvalid, ErrStr: ErrStrTypedJSONInvalid}
+	ErrTypeMismatch            = ErrorType{ErrCode: ErrCodeTypeMismatch, ErrStr: ErrStrTypeMismatch}
+	ErrEndOfContainer          = ErrorType{ErrCode: ErrCodeEndOfContainer, ErrStr: ErrStrEndOfContainer}
+	ErrMapKeyCollision         = ErrorType{ErrCode: ErrCodeMapKeyCollision, ErrStr: ErrStrMapKeyCollision}
+	ErrUnsettableEmbedded      = ErrorType{ErrCode: ErrCodeUnsettableEmbedded, ErrStr: ErrStrUnsettableEmbedded}
 )
 
+// SkipSubtree and StopWalk are returned by a Visitor to steer Walk rather
+// than to report a failure.
 var (
-	ErrUnsupportedType   = ErrorType{ErrCode: ErrCodeUnsupportedType, ErrStr: ErrStrUnsupportedType}
-	ErrStringTooLong     = ErrorType{ErrCode: ErrCodeStringTooLong, ErrStr: ErrStrStringTooLong}
-	ErrValueOutOfRange   = ErrorType{ErrCode: ErrCodeValueOutOfRange, ErrStr: ErrStrValueOutOfRange}
-	ErrBinaryTooLong     = ErrorType{ErrCode: ErrCodeBinaryTooLong, ErrStr: ErrStrBinaryTooLong}
-	ErrBinaryDataInvalid = ErrorType{ErrCode: ErrCodeBinaryDataInvalid, ErrStr: ErrStrBinaryDataInvalid}
-	ErrInitConstants     = ErrorType{ErrCode: ErrCodeInitConstants, ErrStr: ErrStrInitConstants}
-	ErrArrayTooLong      = ErrorType{ErrCode: ErrCodeArrayTooLong, ErrStr: ErrStrArrayTooLong}
-	ErrReadByte          = ErrorType{ErrCode: ErrCodeReadByte, ErrStr: ErrStrReadByte}
-	ErrLengthInvalid     = ErrorType{ErrCode: ErrCodeLengthInvalid, ErrStr: ErrStrLengthInvalid}
+	SkipSubtree = ErrorType{ErrCode: ErrCodeSkipSubtree, ErrStr: ErrStrSkipSubtree}
+	StopWalk    = ErrorType{ErrCode: ErrCodeStopWalk, ErrStr: ErrStrStopWalk}
 )
 
 func (e ErrorType) Error() string {
 	return e.ErrStr
 }
+
+// DecodeError reports where in the input decoding failed. Err is the cause,
+// such as ErrUnsupportedType or io.ErrUnexpectedEOF, and is matched by
+// errors.Is and errors.As.
+type DecodeError struct {
+	// Offset is the position of Format in the input.
+	Offset int64
+	// Format is the format byte of the value that failed, or zero when the
+	// input ended before it.
+	Format byte
+	// Path locates the value inside the document, like friends[2].name.
+	// It is empty for the top-level value.
+	Path string
+	Err  error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("msgpack: %v at offset %d (format 0x%02X)", e.Err, e.Offset, e.Format)
+	}
+	return fmt.Sprintf("msgpack: %v at offset %d (format 0x%02X), path %v", e.Err, e.Offset, e.Format, e.Path)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// newDecodeError wraps err in a DecodeError for the value at offset, unless
+// a nested value already did.
+func newDecodeError(err error, offset int64, format byte) error {
+	if _, ok := err.(*DecodeError); ok {
+		return err
+	}
+	return &DecodeError{Offset: offset, Format: format, Err: unexpectedEOF(err)}
+}
+
+// unexpectedEOF turns io.EOF into io.ErrUnexpectedEOF: once a value has
+// started, running out of input is an error.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// withIndex and withKey prefix the path of a DecodeError with the array
+// index or map key it was found under.
+func withIndex(err error, index int) error {
+	return withPath(err, "["+strconv.Itoa(index)+"]")
+}
+
+func withKey(err error, key interface{}) error {
+	if s, ok := key.(string); ok {
+		if isPathName(s) {
+			return withPath(err, s)
+		}
+		return withPath(err, "["+strconv.Quote(s)+"]")
+	}
+	return withPath(err, fmt.Sprintf("[%v]", key))
+}
+
+func withPath(err error, segment string) error {
+	de, ok := err.(*DecodeError)
+	if !ok {
+		return err
+	}
+
+	if de.Path == "" || strings.HasPrefix(de.Path, "[") {
+		de.Path = segment + de.Path
+	} else {
+		de.Path = segment + "." + de.Path
+	}
+	return de
+}
+
+// isPathName reports whether key can appear unquoted in a path.
+func isPathName(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, r := range key {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,97 @@
+package msgpack
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDecodeError(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      []byte
+		stream     bool
+		wantOffset int64
+		wantFormat byte
+		wantPath   string
+		wantErr    error
+	}{
+		{
+			name: "nested",
+			input: []byte{
+				0x81, 0xA7, 'f', 'r', 'i', 'e', 'n', 'd', 's',
+				0x93, 0x01, 0x02, 0x81, 0xA4, 'n', 'a', 'm', 'e', 0xC1,
+			},
+			wantOffset: 18,
+			wantFormat: 0xC1,
+			wantPath:   "friends[2].name",
+			wantErr:    ErrUnsupportedType,
+		},
+		{name: "top level", input: []byte{0xC1}, wantOffset: 0, wantFormat: 0xC1, wantErr: ErrUnsupportedType},
+		{name: "quoted key", input: []byte{0x81, 0xA3, 'a', ' ', 'b', 0xC1}, wantOffset: 5, wantFormat: 0xC1, wantPath: `["a b"]`, wantErr: ErrUnsupportedType},
+		{name: "int key", input: []byte{0x81, 0x07, 0xC1}, wantOffset: 2, wantFormat: 0xC1, wantPath: "[7]", wantErr: ErrUnsupportedType},
+		{name: "container length", input: []byte{0x91, 0xDC, 0x00, 0x05}, wantOffset: 1, wantFormat: 0xDC, wantPath: "[0]", wantErr: ErrLengthExceedsInput},
+		{name: "input ends before element", input: []byte{0x92, 0x01}, stream: true, wantOffset: 2, wantPath: "[1]", wantErr: io.ErrUnexpectedEOF},
+		{name: "input ends inside element", input: []byte{0x91, 0xCD, 0x01}, stream: true, wantOffset: 1, wantFormat: 0xCD, wantPath: "[0]", wantErr: io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r io.Reader = bytes.NewReader(tt.input)
+			if tt.stream {
+				r = iotest.OneByteReader(r)
+			}
+
+			_, err := NewDecoder(r).Decode()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var de *DecodeError
+			if !errors.As(err, &de) {
+				t.Fatalf("Decode() error = %T, want *DecodeError", err)
+			}
+			if de.Offset != tt.wantOffset || de.Format != tt.wantFormat || de.Path != tt.wantPath {
+				t.Errorf("DecodeError = {Offset: %v, Format: 0x%02X, Path: %q}, want {Offset: %v, Format: 0x%02X, Path: %q}",
+					de.Offset, de.Format, de.Path, tt.wantOffset, tt.wantFormat, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestDecodeErrorCleanEOF(t *testing.T) {
+	if _, err := NewMessagePackDecoder(nil).Decode(); err != io.EOF {
+		t.Errorf("Decode() error = %v, want %v", err, io.EOF)
+	}
+}
+
+func TestUnmarshalDecodeError(t *testing.T) {
+	input := []byte{0x81, 0xA5, 'p', 'o', 'i', 'n', 't', 0x81, 0xA1, 'x', 0xA1, 'a'}
+
+	var record testRecord
+	err := Unmarshal(input, &record)
+
+	var de *DecodeError
+	if !errors.As(err, &de) {
+		t.Fatalf("Unmarshal() error = %v, want *DecodeError", err)
+	}
+	if !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("Unmarshal() error = %v, wantErr %v", err, ErrUnsupportedType)
+	}
+	if de.Offset != 10 || de.Format != 0xA1 || de.Path != "point.x" {
+		t.Errorf("DecodeError = {Offset: %v, Format: 0x%02X, Path: %q}, want {Offset: 10, Format: 0xA1, Path: \"point.x\"}", de.Offset, de.Format, de.Path)
+	}
+}
+
+func TestCanonicalizeDecodeError(t *testing.T) {
+	_, err := Canonicalize([]byte{0x92, 0x01, 0x02, 0x03})
+
+	var de *DecodeError
+	if !errors.As(err, &de) || !errors.Is(err, ErrTrailingData) {
+		t.Fatalf("Canonicalize() error = %v, want a DecodeError for %v", err, ErrTrailingData)
+	}
+	if de.Offset != 3 || de.Format != 0x03 {
+		t.Errorf("DecodeError = {Offset: %v, Format: 0x%02X}, want {Offset: 3, Format: 0x03}", de.Offset, de.Format)
+	}
+}
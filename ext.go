@@ -0,0 +1,152 @@
+package msgpack
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Ext is a MessagePack extension value: an application-defined type ID and
+// the raw bytes of its payload.
+//
+// Decode returns extension values as Ext, and encoding an Ext writes the
+// smallest fixext or ext format that fits Data.
+type Ext struct {
+	Type int8
+	Data []byte
+}
+
+// ExtRegistry maps application-defined Go types to extension type IDs. It is
+// safe for concurrent use.
+type ExtRegistry struct {
+	mu     sync.RWMutex
+	byID   map[int8]*extEntry
+	byType map[reflect.Type]*extEntry
+}
+
+type extEntry struct {
+	id     int8
+	typ    reflect.Type
+	encode func(interface{}) ([]byte, error)
+	decode func([]byte) (interface{}, error)
+}
+
+// defaultExtRegistry is used by encoders and decoders that are not given a
+// registry of their own.
+var defaultExtRegistry = NewExtRegistry()
+
+// NewExtRegistry returns an empty registry, for encoders and decoders that
+// need to override some of the ID assignments of the default registry.
+func NewExtRegistry() *ExtRegistry {
+	return &ExtRegistry{
+		byID:   map[int8]*extEntry{},
+		byType: map[reflect.Type]*extEntry{},
+	}
+}
+
+// RegisterExt registers goType with the default registry. See
+// ExtRegistry.Register.
+func RegisterExt(typeID int8, goType interface{}, encode func(interface{}) ([]byte, error), decode func([]byte) (interface{}, error)) {
+	defaultExtRegistry.Register(typeID, goType, encode, decode)
+}
+
+// Register maps values of the dynamic type of goType to extension typeID.
+// encode turns such a value into the extension payload, and decode turns a
+// payload of typeID back into a value. Either function may be nil to
+// register one direction only. Registering a type or ID again replaces the
+// previous mapping.
+func (r *ExtRegistry) Register(typeID int8, goType interface{}, encode func(interface{}) ([]byte, error), decode func([]byte) (interface{}, error)) {
+	entry := &extEntry{
+		id:     typeID,
+		typ:    reflect.TypeOf(goType),
+		encode: encode,
+		decode: decode,
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if old, ok := r.byID[typeID]; ok {
+		delete(r.byType, old.typ)
+	}
+	if old, ok := r.byType[entry.typ]; ok {
+		delete(r.byID, old.id)
+	}
+
+	r.byID[typeID] = entry
+	r.byType[entry.typ] = entry
+}
+
+func (r *ExtRegistry) lookupID(typeID int8) *extEntry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if entry := r.byID[typeID]; entry != nil && entry.decode != nil {
+		return entry
+	}
+	return nil
+}
+
+func (r *ExtRegistry) lookupType(typ reflect.Type) *extEntry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if entry := r.byType[typ]; entry != nil && entry.encode != nil {
+		return entry
+	}
+	return nil
+}
+
+// lookupExtType finds the encoder of typ in the registry of the options,
+// falling back to the default registry for types it does not define.
+func (es *encodeState) lookupExtType(typ reflect.Type) *extEntry {
+	if es.opts.ExtRegistry != nil {
+		if entry := es.opts.ExtRegistry.lookupType(typ); entry != nil {
+			return entry
+		}
+	}
+	return defaultExtRegistry.lookupType(typ)
+}
+
+func (es *encodeState) encodeRegisteredExt(entry *extEntry, value interface{}) error {
+	data, err := entry.encode(value)
+	if err != nil {
+		return err
+	}
+	es.traceExt(entry.id, entry.typ)
+
+	return encodeExt(es.buf, entry.id, data)
+}
+
+// lookupExtID finds the decoder of typeID in the registry of the options,
+// falling back to the default registry for IDs it does not define.
+func (dec *MessagePackDecoder) lookupExtID(typeID int8) *extEntry {
+	if dec.opts.ExtRegistry != nil {
+		if entry := dec.opts.ExtRegistry.lookupID(typeID); entry != nil {
+			return entry
+		}
+	}
+	return defaultExtRegistry.lookupID(typeID)
+}
+
+// resolveExt converts ext to time.Time or to its registered Go type, if any.
+func (dec *MessagePackDecoder) resolveExt(ext Ext, err error) (interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	if ext.Type == timestampExtType {
+		return decodeTimestamp(ext.Data)
+	}
+
+	entry := dec.lookupExtID(ext.Type)
+	if entry == nil {
+		return ext, nil
+	}
+
+	value, err := entry.decode(ext.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
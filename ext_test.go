@@ -0,0 +1,280 @@
+package msgpack
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestExtRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		length int
+		prefix []byte
+	}{
+		{name: "fixext 1", length: 1, prefix: []byte{0xD4, 0x05}},
+		{name: "fixext 2", length: 2, prefix: []byte{0xD5, 0x05}},
+		{name: "fixext 4", length: 4, prefix: []byte{0xD6, 0x05}},
+		{name: "fixext 8", length: 8, prefix: []byte{0xD7, 0x05}},
+		{name: "fixext 16", length: 16, prefix: []byte{0xD8, 0x05}},
+		{name: "ext 8, size 0", length: 0, prefix: []byte{0xC7, 0x00, 0x05}},
+		{name: "ext 8, size 3", length: 3, prefix: []byte{0xC7, 0x03, 0x05}},
+		{name: "ext 8, size 255", length: 255, prefix: []byte{0xC7, 0xFF, 0x05}},
+		{name: "ext 16, size 256", length: 256, prefix: []byte{0xC8, 0x01, 0x00, 0x05}},
+		{name: "ext 16, size 65535", length: 65535, prefix: []byte{0xC8, 0xFF, 0xFF, 0x05}},
+		{name: "ext 32, size 65536", length: 65536, prefix: []byte{0xC9, 0x00, 0x01, 0x00, 0x00, 0x05}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ext := Ext{Type: 5, Data: bytes.Repeat([]byte{0xAB}, tt.length)}
+
+			var buf bytes.Buffer
+			if err := encode(&buf, ext); err != nil {
+				t.Fatalf("encode() error = %v", err)
+			}
+
+			encoded := buf.Bytes()
+			if !bytes.HasPrefix(encoded, tt.prefix) {
+				t.Errorf("encoded prefix = % X, want % X", encoded[:len(tt.prefix)], tt.prefix)
+			}
+			if len(encoded) != len(tt.prefix)+tt.length {
+				t.Errorf("encoded size = %v, want %v", len(encoded), len(tt.prefix)+tt.length)
+			}
+
+			result, err := NewMessagePackDecoder(encoded).Decode()
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(result, ext) {
+				t.Errorf("Decode() = %v, want %v", result, ext)
+			}
+		})
+	}
+}
+
+func TestExtNegativeType(t *testing.T) {
+	input := []byte{0xD4, 0x80, 0x01, 0xC3}
+
+	decoder := NewMessagePackDecoder(input)
+	result, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if !reflect.DeepEqual(result, Ext{Type: -128, Data: []byte{0x01}}) {
+		t.Errorf("Decode() = %v", result)
+	}
+
+	// the value after the extension must still be readable
+	next, err := decoder.Decode()
+	if err != nil || next != true {
+		t.Errorf("Decode() = %v, %v, want true", next, err)
+	}
+}
+
+func TestExtMarshal(t *testing.T) {
+	type wrapper struct {
+		Raw Ext `msgpack:"raw"`
+	}
+
+	encoded, err := Marshal(wrapper{Raw: Ext{Type: 1, Data: []byte{0x01, 0x02}}})
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	expected := []byte{0x81, 0xA3, 'r', 'a', 'w', 0xD5, 0x01, 0x01, 0x02}
+	if !bytes.Equal(encoded, expected) {
+		t.Errorf("Marshal() = % X, want % X", encoded, expected)
+	}
+
+	var decoded wrapper
+	if err := Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if !reflect.DeepEqual(decoded.Raw, Ext{Type: 1, Data: []byte{0x01, 0x02}}) {
+		t.Errorf("Unmarshal() = %v", decoded.Raw)
+	}
+}
+
+type testRGB struct {
+	R, G, B uint8
+}
+
+func encodeTestRGB(v interface{}) ([]byte, error) {
+	c := v.(testRGB)
+	return []byte{c.R, c.G, c.B}, nil
+}
+
+func decodeTestRGB(data []byte) (interface{}, error) {
+	if len(data) != 3 {
+		return nil, ErrBinaryDataInvalid
+	}
+	return testRGB{R: data[0], G: data[1], B: data[2]}, nil
+}
+
+func TestRegisterExt(t *testing.T) {
+	RegisterExt(10, testRGB{}, encodeTestRGB, decodeTestRGB)
+
+	encoded, err := Marshal(map[string]interface{}{"color": testRGB{1, 2, 3}})
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	expected := []byte{0x81, 0xA5, 'c', 'o', 'l', 'o', 'r', 0xC7, 0x03, 0x0A, 0x01, 0x02, 0x03}
+	if !bytes.Equal(encoded, expected) {
+		t.Errorf("Marshal() = % X, want % X", encoded, expected)
+	}
+
+	var buf bytes.Buffer
+	if err := encode(&buf, []interface{}{testRGB{4, 5, 6}}); err != nil {
+		t.Fatalf("encode() error = %v", err)
+	}
+
+	result, err := NewMessagePackDecoder(buf.Bytes()).Decode()
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if !reflect.DeepEqual(result, []interface{}{testRGB{4, 5, 6}}) {
+		t.Errorf("Decode() = %v", result)
+	}
+
+	var decoded struct {
+		Color testRGB `msgpack:"color"`
+	}
+	if err := Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if decoded.Color != (testRGB{1, 2, 3}) {
+		t.Errorf("Unmarshal() = %v", decoded.Color)
+	}
+}
+
+func TestExtRegistryOverride(t *testing.T) {
+	serviceA := NewExtRegistry()
+	serviceA.Register(20, testRGB{}, encodeTestRGB, decodeTestRGB)
+
+	serviceB := NewExtRegistry()
+	serviceB.Register(21, testRGB{}, encodeTestRGB, decodeTestRGB)
+
+	var out bytes.Buffer
+	if err := NewEncoderWithOptions(&out, EncoderOptions{ExtRegistry: serviceA}).Encode(testRGB{7, 8, 9}); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if err := NewEncoderWithOptions(&out, EncoderOptions{ExtRegistry: serviceB}).Encode(testRGB{7, 8, 9}); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	expected := []byte{0xC7, 0x03, 0x14, 0x07, 0x08, 0x09, 0xC7, 0x03, 0x15, 0x07, 0x08, 0x09}
+	if !bytes.Equal(out.Bytes(), expected) {
+		t.Fatalf("Encode() wrote % X, want % X", out.Bytes(), expected)
+	}
+
+	// a decoder knows the IDs of its own registry and the default one only
+	decoder := NewDecoderWithOptions(bytes.NewReader(out.Bytes()), DecoderOptions{ExtRegistry: serviceB})
+
+	first, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if !reflect.DeepEqual(first, Ext{Type: 20, Data: []byte{7, 8, 9}}) {
+		t.Errorf("Decode() = %v, want raw Ext", first)
+	}
+
+	second, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if second != (testRGB{7, 8, 9}) {
+		t.Errorf("Decode() = %v, want testRGB", second)
+	}
+}
+
+// testDecodeOnly is never registered with an encode function, here or in
+// the default registry.
+type testDecodeOnly struct {
+	R, G, B uint8
+}
+
+func TestExtRegistryDecodeError(t *testing.T) {
+	registry := NewExtRegistry()
+	registry.Register(30, testDecodeOnly{}, nil, decodeTestRGB)
+
+	decoder := NewDecoderWithOptions(bytes.NewReader([]byte{0xD4, 0x1E, 0x01}), DecoderOptions{ExtRegistry: registry})
+	if _, err := decoder.Decode(); !errors.Is(err, ErrBinaryDataInvalid) {
+		t.Errorf("Decode() error = %v, wantErr %v", err, ErrBinaryDataInvalid)
+	}
+
+	// without an encode function the value is encoded as a plain struct
+	var out bytes.Buffer
+	if err := NewEncoderWithOptions(&out, EncoderOptions{ExtRegistry: registry}).Encode(testDecodeOnly{}); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if out.Bytes()[0] != 0x83 {
+		t.Errorf("Encode() wrote % X, want a fixmap of 3 fields", out.Bytes())
+	}
+}
+
+type testGray struct {
+	V uint8
+}
+
+func encodeTestGray(v interface{}) ([]byte, error) {
+	return []byte{v.(testGray).V}, nil
+}
+
+func decodeTestGray(data []byte) (interface{}, error) {
+	if len(data) != 1 {
+		return nil, ErrBinaryDataInvalid
+	}
+	return testGray{V: data[0]}, nil
+}
+
+func TestExtRegistryFallsBackToDefault(t *testing.T) {
+	RegisterExt(40, testGray{}, encodeTestGray, decodeTestGray)
+
+	registry := NewExtRegistry()
+	registry.Register(41, testRGB{}, encodeTestRGB, decodeTestRGB)
+
+	override := NewExtRegistry()
+	override.Register(42, testGray{}, encodeTestGray, decodeTestGray)
+
+	tests := []struct {
+		name     string
+		registry *ExtRegistry
+		value    interface{}
+		encoded  []byte
+	}{
+		{name: "own type", registry: registry, value: testRGB{1, 2, 3}, encoded: []byte{0xC7, 0x03, 0x29, 0x01, 0x02, 0x03}},
+		{name: "default type", registry: registry, value: testGray{4}, encoded: []byte{0xD4, 0x28, 0x04}},
+		{name: "overridden type", registry: override, value: testGray{5}, encoded: []byte{0xD4, 0x2A, 0x05}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := NewEncoderWithOptions(&out, EncoderOptions{ExtRegistry: tt.registry}).Encode(tt.value); err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			if !bytes.Equal(out.Bytes(), tt.encoded) {
+				t.Fatalf("Encode() wrote % X, want % X", out.Bytes(), tt.encoded)
+			}
+
+			decoded, err := NewDecoderWithOptions(&out, DecoderOptions{ExtRegistry: tt.registry}).Decode()
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if decoded != tt.value {
+				t.Errorf("Decode() = %v, want %v", decoded, tt.value)
+			}
+		})
+	}
+
+	// an ID the instance registry defines shadows the default one
+	registry.Register(40, testRGB{}, encodeTestRGB, decodeTestRGB)
+	decoded, err := NewDecoderWithOptions(bytes.NewReader([]byte{0xC7, 0x03, 0x28, 0x01, 0x02, 0x03}), DecoderOptions{ExtRegistry: registry}).Decode()
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if decoded != (testRGB{1, 2, 3}) {
+		t.Errorf("Decode() = %v, want testRGB", decoded)
+	}
+}
@@ -0,0 +1,196 @@
+package msgpack
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// field describes an exported struct field as seen by Marshal and Unmarshal.
+type field struct {
+	name      string
+	index     []int
+	typ       reflect.Type
+	omitEmpty bool
+}
+
+var (
+	fieldCache          sync.Map // map[reflect.Type][]field
+	canonicalFieldCache sync.Map // map[reflect.Type][]field
+)
+
+// cachedFields returns the encodable fields of struct type t, computing them
+// once per type.
+func cachedFields(t reflect.Type) []field {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.([]field)
+	}
+	f, _ := fieldCache.LoadOrStore(t, typeFields(t))
+	return f.([]field)
+}
+
+// canonicalFields returns the fields of cachedFields sorted in canonical key
+// order.
+func canonicalFields(t reflect.Type) []field {
+	if f, ok := canonicalFieldCache.Load(t); ok {
+		return f.([]field)
+	}
+
+	fields := append([]field(nil), cachedFields(t)...)
+	sort.SliceStable(fields, func(i, j int) bool {
+		return canonicalStringLess(fields[i].name, fields[j].name)
+	})
+
+	f, _ := canonicalFieldCache.LoadOrStore(t, fields)
+	return f.([]field)
+}
+
+// typeFields walks t and its embedded structs breadth first. Fields of
+// untagged embedded structs are promoted; a name seen at a shallower depth
+// hides the same name further down. Like encoding/json, several fields with
+// the same name at the same depth are all dropped unless exactly one of them
+// is tagged, which then wins.
+func typeFields(t reflect.Type) []field {
+	type queued struct {
+		typ   reflect.Type
+		index []int
+	}
+
+	var fields []field
+	seen := map[string]bool{}
+	visited := map[reflect.Type]bool{}
+
+	current := []queued{}
+	next := []queued{{typ: t}}
+
+	for len(next) > 0 {
+		current, next = next, current[:0]
+
+		// the candidates at this depth, and whether each was named by a tag
+		var candidates []field
+		var tagged []bool
+
+		for _, q := range current {
+			if visited[q.typ] {
+				continue
+			}
+			visited[q.typ] = true
+
+			for i := 0; i < q.typ.NumField(); i++ {
+				sf := q.typ.Field(i)
+
+				tagValue := sf.Tag.Get("msgpack")
+				if tagValue == "-" {
+					continue
+				}
+				name, opts, _ := strings.Cut(tagValue, ",")
+
+				index := make([]int, len(q.index)+1)
+				copy(index, q.index)
+				index[len(q.index)] = i
+
+				ft := sf.Type
+				if ft.Kind() == reflect.Pointer && ft.Name() == "" {
+					ft = ft.Elem()
+				}
+
+				if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+					next = append(next, queued{typ: ft, index: index})
+					continue
+				}
+				if !sf.IsExported() {
+					continue
+				}
+
+				isTagged := name != ""
+				if name == "" {
+					name = sf.Name
+				}
+				if seen[name] {
+					continue
+				}
+
+				tagged = append(tagged, isTagged)
+				candidates = append(candidates, field{
+					name:      name,
+					index:     index,
+					typ:       sf.Type,
+					omitEmpty: hasOption(opts, "omitempty"),
+				})
+			}
+		}
+
+		fields = append(fields, dominantFields(candidates, tagged)...)
+		for _, f := range candidates {
+			seen[f.name] = true
+		}
+	}
+
+	return fields
+}
+
+// dominantFields keeps the candidates whose name no other candidate at the
+// same depth has, and of those that share a name the only tagged one.
+func dominantFields(candidates []field, tagged []bool) []field {
+	count := map[string]int{}
+	taggedCount := map[string]int{}
+	for i, f := range candidates {
+		count[f.name]++
+		if tagged[i] {
+			taggedCount[f.name]++
+		}
+	}
+
+	var fields []field
+	for i, f := range candidates {
+		if count[f.name] == 1 || tagged[i] && taggedCount[f.name] == 1 {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+func hasOption(opts, option string) bool {
+	for opts != "" {
+		var name string
+		name, opts, _ = strings.Cut(opts, ",")
+		if name == option {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldByIndex is like reflect.Value.FieldByIndex but reports false instead
+// of panicking when it meets a nil embedded pointer.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
+}
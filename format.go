@@ -0,0 +1,125 @@
+package msgpack
+
+import "strconv"
+
+// Format bytes of the MessagePack spec. The fix formats carry their value or
+// length in the low bits and are given as the first and last byte of their
+// range.
+const (
+	FormatPositiveFixintMin byte = 0x00
+	FormatPositiveFixintMax byte = 0x7F
+	FormatFixmapMin         byte = 0x80
+	FormatFixmapMax         byte = 0x8F
+	FormatFixarrayMin       byte = 0x90
+	FormatFixarrayMax       byte = 0x9F
+	FormatFixstrMin         byte = 0xA0
+	FormatFixstrMax         byte = 0xBF
+	FormatNil               byte = 0xC0
+	FormatNeverUsed         byte = 0xC1
+	FormatFalse             byte = 0xC2
+	FormatTrue              byte = 0xC3
+	FormatBin8              byte = 0xC4
+	FormatBin16             byte = 0xC5
+	FormatBin32             byte = 0xC6
+	FormatExt8              byte = 0xC7
+	FormatExt16             byte = 0xC8
+	FormatExt32             byte = 0xC9
+	FormatFloat32           byte = 0xCA
+	FormatFloat64           byte = 0xCB
+	FormatUint8             byte = 0xCC
+	FormatUint16            byte = 0xCD
+	FormatUint32            byte = 0xCE
+	FormatUint64            byte = 0xCF
+	FormatInt8              byte = 0xD0
+	FormatInt16             byte = 0xD1
+	FormatInt32             byte = 0xD2
+	FormatInt64             byte = 0xD3
+	FormatFixext1           byte = 0xD4
+	FormatFixext2           byte = 0xD5
+	FormatFixext4           byte = 0xD6
+	FormatFixext8           byte = 0xD7
+	FormatFixext16          byte = 0xD8
+	FormatStr8              byte = 0xD9
+	FormatStr16             byte = 0xDA
+	FormatStr32             byte = 0xDB
+	FormatArray16           byte = 0xDC
+	FormatArray32           byte = 0xDD
+	FormatMap16             byte = 0xDE
+	FormatMap32             byte = 0xDF
+	FormatNegativeFixintMin byte = 0xE0
+	FormatNegativeFixintMax byte = 0xFF
+)
+
+// Type is the kind of value a format byte introduces.
+type Type int
+
+const (
+	InvalidType Type = iota // the never used format 0xC1
+	NilType
+	BoolType
+	IntType // the fixint, int and uint formats
+	FloatType
+	StrType
+	BinType
+	ArrayType
+	MapType
+	ExtType // including timestamps
+)
+
+var typeNames = [...]string{
+	InvalidType: "invalid",
+	NilType:     "nil",
+	BoolType:    "bool",
+	IntType:     "int",
+	FloatType:   "float",
+	StrType:     "str",
+	BinType:     "bin",
+	ArrayType:   "array",
+	MapType:     "map",
+	ExtType:     "ext",
+}
+
+func (t Type) String() string {
+	if t < 0 || int(t) >= len(typeNames) {
+		return "Type(" + strconv.Itoa(int(t)) + ")"
+	}
+	return typeNames[t]
+}
+
+// TypeOf returns the type of the value introduced by format byte b.
+func TypeOf(b byte) Type {
+	switch {
+	case b <= FormatPositiveFixintMax, b >= FormatNegativeFixintMin:
+		return IntType
+	case b <= FormatFixmapMax:
+		return MapType
+	case b <= FormatFixarrayMax:
+		return ArrayType
+	case b <= FormatFixstrMax:
+		return StrType
+	}
+
+	switch b {
+	case FormatNil:
+		return NilType
+	case FormatFalse, FormatTrue:
+		return BoolType
+	case FormatBin8, FormatBin16, FormatBin32:
+		return BinType
+	case FormatExt8, FormatExt16, FormatExt32,
+		FormatFixext1, FormatFixext2, FormatFixext4, FormatFixext8, FormatFixext16:
+		return ExtType
+	case FormatFloat32, FormatFloat64:
+		return FloatType
+	case FormatUint8, FormatUint16, FormatUint32, FormatUint64,
+		FormatInt8, FormatInt16, FormatInt32, FormatInt64:
+		return IntType
+	case FormatStr8, FormatStr16, FormatStr32:
+		return StrType
+	case FormatArray16, FormatArray32:
+		return ArrayType
+	case FormatMap16, FormatMap32:
+		return MapType
+	}
+	return InvalidType
+}
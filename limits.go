@@ -0,0 +1,133 @@
+package msgpack
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// DefaultMaxDepth is the nesting limit used when DecoderOptions.MaxDepth is
+// zero. It keeps hostile input from exhausting the stack.
+const DefaultMaxDepth = 10000
+
+const (
+	// slotSize is what the allocation budget charges for each decoded
+	// array element or map key and value, the size of an interface value.
+	slotSize = 16
+
+	// maxPrealloc caps the capacity reserved up front for containers and
+	// payloads whose length cannot be checked against the remaining input.
+	maxPrealloc = 4096
+)
+
+// remaining reports how many bytes are left in the input, or -1 when the
+// reader cannot tell, as for streams.
+func (dec *MessagePackDecoder) remaining() int {
+	if r, ok := dec.reader.r.(interface{ Len() int }); ok {
+		return r.Len()
+	}
+	return -1
+}
+
+// capHint returns the capacity to reserve for length items. Lengths that
+// were checked against the input are trusted; others are capped so memory
+// only grows with data that actually arrives.
+func (dec *MessagePackDecoder) capHint(length int) int {
+	if dec.remaining() < 0 && length > maxPrealloc {
+		return maxPrealloc
+	}
+	return length
+}
+
+// charge adds n bytes to the allocation budget of the current value.
+func (dec *MessagePackDecoder) charge(n int) error {
+	dec.allocated += n
+	if dec.opts.MaxAlloc > 0 && dec.allocated > dec.opts.MaxAlloc {
+		dec.traceLimit("MaxAlloc", dec.allocated, dec.opts.MaxAlloc)
+		return ErrMaxAllocExceeded
+	}
+	return nil
+}
+
+// enterContainer checks an array or map of length entries, each made of
+// slots values, against the limits before anything is allocated for it.
+// Every successful call must be paired with leaveContainer.
+func (dec *MessagePackDecoder) enterContainer(length, slots int) error {
+	if err := dec.checkContainer(length, slots); err != nil {
+		return err
+	}
+
+	if err := dec.charge(length * slots * slotSize); err != nil {
+		return err
+	}
+
+	dec.depth++
+	return nil
+}
+
+// checkContainer is enterContainer without the allocation charge, for
+// containers that are passed through rather than built.
+func (dec *MessagePackDecoder) checkContainer(length, slots int) error {
+	maxDepth := dec.opts.MaxDepth
+	if maxDepth == 0 {
+		maxDepth = DefaultMaxDepth
+	}
+	if maxDepth > 0 && dec.depth >= maxDepth {
+		dec.traceLimit("MaxDepth", dec.depth+1, maxDepth)
+		return ErrMaxDepthExceeded
+	}
+
+	if dec.opts.MaxContainerLen > 0 && length > dec.opts.MaxContainerLen {
+		dec.traceLimit("MaxContainerLen", length, dec.opts.MaxContainerLen)
+		return ErrMaxContainerLenExceeded
+	}
+
+	// every value takes at least one byte on the wire
+	if remaining := dec.remaining(); remaining >= 0 && length > remaining/slots {
+		dec.traceLimit("remaining input", length*slots, remaining)
+		return ErrLengthExceedsInput
+	}
+
+	return nil
+}
+
+func (dec *MessagePackDecoder) leaveContainer() {
+	dec.depth--
+}
+
+// readBytes reads a payload of length bytes, returning errLimit when it is
+// longer than limit. Payloads longer than the remaining input are rejected
+// before allocating; on streams the buffer grows as the data arrives.
+func (dec *MessagePackDecoder) readBytes(length, limit int, errLimit ErrorType) ([]byte, error) {
+	if limit > 0 && length > limit {
+		dec.traceLimit(strings.TrimSuffix(errLimit.ErrStr, "Exceeded"), length, limit)
+		return nil, errLimit
+	}
+
+	remaining := dec.remaining()
+	if remaining >= 0 && length > remaining {
+		dec.traceLimit("remaining input", length, remaining)
+		return nil, ErrLengthExceedsInput
+	}
+
+	if err := dec.charge(length); err != nil {
+		return nil, err
+	}
+
+	if remaining >= 0 || length <= maxPrealloc {
+		data := make([]byte, length)
+		if _, err := io.ReadFull(dec.reader, data); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, dec.reader, int64(length)); err != nil {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,89 @@
+package msgpack
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDecoderLimits(t *testing.T) {
+	nested := func(depth int) []byte {
+		return append(bytes.Repeat([]byte{0x91}, depth), 0xC0)
+	}
+
+	tests := []struct {
+		name    string
+		input   []byte
+		opts    DecoderOptions
+		stream  bool
+		wantErr error
+	}{
+		{name: "array longer than input", input: []byte{0xDD, 0xFF, 0xFF, 0xFF, 0xFF}, wantErr: ErrLengthExceedsInput},
+		{name: "map longer than input", input: []byte{0x82, 0x01, 0x02, 0x03}, wantErr: ErrLengthExceedsInput},
+		{name: "bin longer than input", input: []byte{0xC6, 0xFF, 0xFF, 0xFF, 0xFF, 0x00}, wantErr: ErrLengthExceedsInput},
+		{name: "str longer than input", input: []byte{0xDB, 0xFF, 0xFF, 0xFF, 0xFF}, wantErr: ErrLengthExceedsInput},
+		{name: "ext longer than input", input: []byte{0xC9, 0xFF, 0xFF, 0xFF, 0xFF, 0x01}, wantErr: ErrLengthExceedsInput},
+		{name: "streamed array truncated", input: []byte{0xDD, 0xFF, 0xFF, 0xFF, 0xFF}, stream: true, wantErr: io.ErrUnexpectedEOF},
+		{name: "streamed bin truncated", input: []byte{0xC6, 0xFF, 0xFF, 0xFF, 0xFF, 0x00}, stream: true, wantErr: io.ErrUnexpectedEOF},
+		{name: "max depth", input: nested(3), opts: DecoderOptions{MaxDepth: 2}, wantErr: ErrMaxDepthExceeded},
+		{name: "within max depth", input: nested(2), opts: DecoderOptions{MaxDepth: 2}},
+		{name: "default max depth", input: nested(DefaultMaxDepth + 1), wantErr: ErrMaxDepthExceeded},
+		{name: "depth check disabled", input: nested(DefaultMaxDepth + 1), opts: DecoderOptions{MaxDepth: -1}},
+		{name: "max container len", input: []byte{0x93, 0x01, 0x02, 0x03}, opts: DecoderOptions{MaxContainerLen: 2}, wantErr: ErrMaxContainerLenExceeded},
+		{name: "max container len map", input: []byte{0x82, 0x01, 0x02, 0x03, 0x04}, opts: DecoderOptions{MaxContainerLen: 1}, wantErr: ErrMaxContainerLenExceeded},
+		{name: "max string len", input: []byte{0xA3, 'f', 'o', 'o'}, opts: DecoderOptions{MaxStringLen: 2}, wantErr: ErrMaxStringLenExceeded},
+		{name: "max bin len", input: []byte{0xC4, 0x02, 0x01, 0x02}, opts: DecoderOptions{MaxBinLen: 1}, wantErr: ErrMaxBinLenExceeded},
+		{name: "max bin len ext", input: []byte{0xD5, 0x01, 0x01, 0x02}, opts: DecoderOptions{MaxBinLen: 1}, wantErr: ErrMaxBinLenExceeded},
+		{name: "max alloc", input: []byte{0x92, 0xA3, 'f', 'o', 'o', 0xA3, 'b', 'a', 'r'}, opts: DecoderOptions{MaxAlloc: 35}, wantErr: ErrMaxAllocExceeded},
+		{name: "within max alloc", input: []byte{0x92, 0xA3, 'f', 'o', 'o', 0xA3, 'b', 'a', 'r'}, opts: DecoderOptions{MaxAlloc: 38}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r io.Reader = bytes.NewReader(tt.input)
+			if tt.stream {
+				r = iotest.OneByteReader(r)
+			}
+
+			_, err := NewDecoderWithOptions(r, tt.opts).Decode()
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecoderAllocBudgetPerValue(t *testing.T) {
+	input := []byte{0x91, 0x01, 0x91, 0x02}
+
+	decoder := NewDecoderWithOptions(bytes.NewReader(input), DecoderOptions{MaxAlloc: 20})
+	for i := 0; i < 2; i++ {
+		if _, err := decoder.Decode(); err != nil {
+			t.Fatalf("Decode() #%v error = %v", i, err)
+		}
+	}
+}
+
+func TestUnmarshalLimits(t *testing.T) {
+	var s []int
+	if err := Unmarshal([]byte{0xDD, 0xFF, 0xFF, 0xFF, 0xFF}, &s); !errors.Is(err, ErrLengthExceedsInput) {
+		t.Errorf("Unmarshal() error = %v, wantErr %v", err, ErrLengthExceedsInput)
+	}
+
+	var m map[int]int
+	if err := Unmarshal([]byte{0xDF, 0xFF, 0xFF, 0xFF, 0xFF}, &m); !errors.Is(err, ErrLengthExceedsInput) {
+		t.Errorf("Unmarshal() error = %v, wantErr %v", err, ErrLengthExceedsInput)
+	}
+
+	var v interface{}
+	if err := Unmarshal(append(bytes.Repeat([]byte{0x91}, DefaultMaxDepth+1), 0xC0), &v); !errors.Is(err, ErrMaxDepthExceeded) {
+		t.Errorf("Unmarshal() error = %v, wantErr %v", err, ErrMaxDepthExceeded)
+	}
+}
+
+func TestCanonicalizeLimits(t *testing.T) {
+	if _, err := Canonicalize([]byte{0xDF, 0xFF, 0xFF, 0xFF, 0xFF}); !errors.Is(err, ErrLengthExceedsInput) {
+		t.Errorf("Canonicalize() error = %v, wantErr %v", err, ErrLengthExceedsInput)
+	}
+}
@@ -0,0 +1,108 @@
+package msgpack
+
+import (
+	"context"
+	"log/slog"
+	"reflect"
+)
+
+// The trace methods log at debug level through the Logger in the options.
+// They take plain arguments and build attributes only once a logger is set,
+// so tracing costs nothing when it is off.
+
+func (dec *MessagePackDecoder) traceFormat(msg string, offset int64, b byte) {
+	if dec.opts.Logger == nil {
+		return
+	}
+	dec.opts.Logger.LogAttrs(context.Background(), slog.LevelDebug, msg,
+		slog.Int64("offset", offset),
+		slog.String("format", formatName(b)),
+		slog.Int("depth", dec.depth),
+	)
+}
+
+func (dec *MessagePackDecoder) traceTarget(offset int64, b byte, t reflect.Type) {
+	if dec.opts.Logger == nil {
+		return
+	}
+	dec.opts.Logger.LogAttrs(context.Background(), slog.LevelDebug, "decode into",
+		slog.Int64("offset", offset),
+		slog.String("format", formatName(b)),
+		slog.Int("depth", dec.depth),
+		slog.Any("type", t),
+	)
+}
+
+func (dec *MessagePackDecoder) traceLimit(limit string, length, max int) {
+	if dec.opts.Logger == nil {
+		return
+	}
+	dec.opts.Logger.LogAttrs(context.Background(), slog.LevelDebug, "limit exceeded",
+		slog.String("limit", limit),
+		slog.Int("length", length),
+		slog.Int("max", max),
+		slog.Int64("offset", dec.reader.offset),
+	)
+}
+
+func (dec *MessagePackDecoder) traceError(msg string, err error) {
+	if dec.opts.Logger == nil {
+		return
+	}
+	dec.opts.Logger.LogAttrs(context.Background(), slog.LevelDebug, msg, slog.Any("err", err))
+}
+
+func (es *encodeState) traceType(msg string, t reflect.Type) {
+	if es.opts.Logger == nil {
+		return
+	}
+	es.opts.Logger.LogAttrs(context.Background(), slog.LevelDebug, msg, slog.Any("type", t))
+}
+
+func (es *encodeState) traceExt(id int8, t reflect.Type) {
+	if es.opts.Logger == nil {
+		return
+	}
+	es.opts.Logger.LogAttrs(context.Background(), slog.LevelDebug, "encode registered ext",
+		slog.Int("ext", int(id)),
+		slog.Any("type", t),
+	)
+}
+
+func (es *encodeState) traceError(msg string, err error) {
+	if es.opts.Logger == nil {
+		return
+	}
+	es.opts.Logger.LogAttrs(context.Background(), slog.LevelDebug, msg, slog.Any("err", err))
+}
+
+// formatName names the format a format byte introduces, as the
+// MessagePack specification does.
+func formatName(b byte) string {
+	switch {
+	case b <= 0x7F:
+		return "positive fixint"
+	case b <= 0x8F:
+		return "fixmap"
+	case b <= 0x9F:
+		return "fixarray"
+	case b <= 0xBF:
+		return "fixstr"
+	case b >= 0xE0:
+		return "negative fixint"
+	}
+	return formatNames[b-0xC0]
+}
+
+var formatNames = [...]string{
+	"nil", "(never used)", "false", "true",
+	"bin 8", "bin 16", "bin 32",
+	"ext 8", "ext 16", "ext 32",
+	"float 32", "float 64",
+	"uint 8", "uint 16", "uint 32", "uint 64",
+	"int 8", "int 16", "int 32", "int 64",
+	"fixext 1", "fixext 2", "fixext 4", "fixext 8", "fixext 16",
+	"str 8", "str 16", "str 32",
+	"array 16", "array 32",
+	"map 16", "map 32",
+}
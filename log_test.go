@@ -0,0 +1,101 @@
+package msgpack
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+)
+
+func newTestLogger(buf *bytes.Buffer) *slog.Logger {
+	return slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+func TestDecoderLogger(t *testing.T) {
+	var logs bytes.Buffer
+	opts := DecoderOptions{Logger: newTestLogger(&logs), MaxStringLen: 1}
+
+	decoder := NewDecoderWithOptions(bytes.NewReader([]byte{0x91, 0xCD, 0x01, 0x00, 0xA2, 'h', 'i'}), opts)
+	if _, err := decoder.Decode(); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if _, err := decoder.Decode(); err == nil {
+		t.Fatalf("Decode() error = nil, want %v", ErrMaxStringLenExceeded)
+	}
+
+	for _, want := range []string{
+		`msg=decode offset=0 format=fixarray depth=0`,
+		`msg=decode offset=1 format="uint 16" depth=1`,
+		`msg="limit exceeded" limit=MaxStringLen length=2 max=1`,
+		`msg="decode failed"`,
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("logs missing %q, got:\n%v", want, logs.String())
+		}
+	}
+}
+
+func TestEncoderLogger(t *testing.T) {
+	var logs bytes.Buffer
+	enc := NewEncoderWithOptions(io.Discard, EncoderOptions{Logger: newTestLogger(&logs)})
+
+	if err := enc.Encode(testPoint{X: 1}); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if err := enc.Encode(make(chan int)); err == nil {
+		t.Fatalf("Encode() error = nil, want %v", ErrUnsupportedType)
+	}
+
+	for _, want := range []string{
+		`msg=encode type=msgpack.testPoint`,
+		`msg=encode type=int`,
+		`msg="encode failed" err=UnsupportedType`,
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("logs missing %q, got:\n%v", want, logs.String())
+		}
+	}
+}
+
+func TestSilentByDefault(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	Marshal(make(chan int))
+	Unmarshal([]byte{0x81, 0xC1}, new(interface{}))
+	Canonicalize([]byte{0x92})
+	JSONToMessagePack([]byte(`{`))
+
+	w.Close()
+	out, _ := io.ReadAll(r)
+	if len(out) != 0 {
+		t.Errorf("stdout = %q, want nothing", out)
+	}
+}
+
+func TestFormatName(t *testing.T) {
+	tests := map[byte]string{
+		0x00: "positive fixint",
+		0x85: "fixmap",
+		0x9F: "fixarray",
+		0xA0: "fixstr",
+		0xC0: "nil",
+		0xC1: "(never used)",
+		0xCA: "float 32",
+		0xD8: "fixext 16",
+		0xDF: "map 32",
+		0xFF: "negative fixint",
+	}
+	for b, want := range tests {
+		if got := formatName(b); got != want {
+			t.Errorf("formatName(0x%02X) = %q, want %q", b, got, want)
+		}
+	}
+}
@@ -0,0 +1,569 @@
+package msgpack
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Mapping is a compiled set of rules telling the JSON bridge which JSON
+// values to write as MessagePack types that JSON lacks, and how to turn them
+// back. A Mapping is never modified after ParseMapping, so it may be shared
+// between goroutines.
+type Mapping struct {
+	rules []mappingRule
+}
+
+type mappingRule struct {
+	pattern    []patternStep
+	conversion conversion
+}
+
+type stepKind int
+
+const (
+	stepKey      stepKind = iota // a map key of that name
+	stepAnyKey                   // *, any single map key
+	stepAnyDepth                 // **, any number of keys and elements
+	stepElem                     // [], the elements of an array
+)
+
+type patternStep struct {
+	kind stepKind
+	name string
+}
+
+// pathStep is one step from the document root: a map key, or an array
+// element when elem is set.
+type pathStep struct {
+	key  string
+	elem bool
+}
+
+type conversionKind int
+
+const (
+	convBin conversionKind = iota
+	convTimestamp
+	convInt
+	convUint
+	convFloat
+	convExt
+)
+
+type conversion struct {
+	kind     conversionKind
+	encoding string // base64 or hex for bin and ext, rfc3339 or unix for timestamps
+	bits     int
+	extType  int8
+}
+
+// rawValue is MessagePack the encoder writes as is, for values whose format
+// a rule fixes rather than leaving to the smallest encoding.
+type rawValue []byte
+
+// ParseMapping compiles rules of the form "pattern -> conversion". The first
+// rule whose pattern matches a value applies.
+//
+// A pattern is a dot-separated path from the document root. A segment is a
+// map key, * for any single key or ** for any depth, and [] after a segment
+// selects the elements of the array found there:
+//
+//	payload.*.blob -> bin(base64)
+//	**.created_at  -> timestamp(rfc3339)
+//	ids[]          -> uint32
+//	raw            -> ext(5, hex)
+//
+// Conversions are bin(base64|hex), timestamp(rfc3339|unix), ext(type,
+// base64|hex), int8 to int64, uint8 to uint64, float32 and float64. Integer
+// and float conversions always use the format they name. MessagePack
+// timestamps carry no UTC offset, so rfc3339 strings come back in UTC:
+// "2024-01-01T10:00:00+02:00" turns into "2024-01-01T08:00:00Z".
+func ParseMapping(rules []string) (*Mapping, error) {
+	m := &Mapping{}
+
+	for _, rule := range rules {
+		patternStr, conversionStr, ok := strings.Cut(rule, "->")
+		if !ok {
+			return nil, ErrMappingInvalid
+		}
+
+		pattern, err := parsePattern(strings.TrimSpace(patternStr))
+		if err != nil {
+			return nil, err
+		}
+
+		c, err := parseConversion(strings.TrimSpace(conversionStr))
+		if err != nil {
+			return nil, err
+		}
+
+		m.rules = append(m.rules, mappingRule{pattern: pattern, conversion: c})
+	}
+
+	return m, nil
+}
+
+func parsePattern(s string) ([]patternStep, error) {
+	if s == "" {
+		return nil, ErrMappingInvalid
+	}
+
+	var steps []patternStep
+	for _, segment := range strings.Split(s, ".") {
+		name := segment
+		elems := 0
+		for strings.HasSuffix(name, "[]") {
+			name = strings.TrimSuffix(name, "[]")
+			elems++
+		}
+
+		switch {
+		case strings.ContainsAny(name, "[]"):
+			return nil, ErrMappingInvalid
+		case name == "":
+			// only a leading [] may stand without a key, for a root array
+			if elems == 0 || len(steps) > 0 {
+				return nil, ErrMappingInvalid
+			}
+		case name == "*":
+			steps = append(steps, patternStep{kind: stepAnyKey})
+		case name == "**":
+			if elems > 0 {
+				return nil, ErrMappingInvalid
+			}
+			steps = append(steps, patternStep{kind: stepAnyDepth})
+		default:
+			steps = append(steps, patternStep{kind: stepKey, name: name})
+		}
+
+		for i := 0; i < elems; i++ {
+			steps = append(steps, patternStep{kind: stepElem})
+		}
+	}
+
+	return steps, nil
+}
+
+func parseConversion(s string) (conversion, error) {
+	name, args := s, []string(nil)
+	if open := strings.IndexByte(s, '('); open >= 0 {
+		if !strings.HasSuffix(s, ")") {
+			return conversion{}, ErrMappingInvalid
+		}
+		name = strings.TrimSpace(s[:open])
+		for _, arg := range strings.Split(s[open+1:len(s)-1], ",") {
+			args = append(args, strings.TrimSpace(arg))
+		}
+	}
+
+	switch name {
+	case "bin":
+		encoding, err := parseByteEncoding(args)
+		return conversion{kind: convBin, encoding: encoding}, err
+
+	case "timestamp":
+		c := conversion{kind: convTimestamp, encoding: "rfc3339"}
+		switch {
+		case len(args) == 0:
+		case len(args) == 1 && (args[0] == "rfc3339" || args[0] == "unix"):
+			c.encoding = args[0]
+		default:
+			return conversion{}, ErrMappingInvalid
+		}
+		return c, nil
+
+	case "ext":
+		if len(args) == 0 {
+			return conversion{}, ErrMappingInvalid
+		}
+		extType, err := strconv.ParseInt(args[0], 10, 8)
+		if err != nil {
+			return conversion{}, ErrMappingInvalid
+		}
+		encoding, err := parseByteEncoding(args[1:])
+		return conversion{kind: convExt, extType: int8(extType), encoding: encoding}, err
+
+	case "int8", "int16", "int32", "int64":
+		n, _ := strconv.Atoi(name[3:])
+		return conversion{kind: convInt, bits: n}, noArgs(args)
+
+	case "uint8", "uint16", "uint32", "uint64":
+		n, _ := strconv.Atoi(name[4:])
+		return conversion{kind: convUint, bits: n}, noArgs(args)
+
+	case "float32", "float64":
+		n, _ := strconv.Atoi(name[5:])
+		return conversion{kind: convFloat, bits: n}, noArgs(args)
+	}
+
+	return conversion{}, ErrMappingInvalid
+}
+
+// parseByteEncoding reads the optional encoding of bin and ext payloads,
+// base64 unless given.
+func parseByteEncoding(args []string) (string, error) {
+	switch {
+	case len(args) == 0:
+		return "base64", nil
+	case len(args) == 1 && (args[0] == "base64" || args[0] == "hex"):
+		return args[0], nil
+	}
+	return "", ErrMappingInvalid
+}
+
+func noArgs(args []string) error {
+	if len(args) > 0 {
+		return ErrMappingInvalid
+	}
+	return nil
+}
+
+// match returns the conversion of the first rule matching path.
+func (m *Mapping) match(path []pathStep) *conversion {
+	for i := range m.rules {
+		if matchPattern(m.rules[i].pattern, path) {
+			return &m.rules[i].conversion
+		}
+	}
+	return nil
+}
+
+func matchPattern(pattern []patternStep, path []pathStep) bool {
+	if len(pattern) == 0 {
+		return len(path) == 0
+	}
+
+	if pattern[0].kind == stepAnyDepth {
+		for i := 0; i <= len(path); i++ {
+			if matchPattern(pattern[1:], path[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(path) == 0 {
+		return false
+	}
+
+	switch pattern[0].kind {
+	case stepKey:
+		if path[0].elem || path[0].key != pattern[0].name {
+			return false
+		}
+	case stepAnyKey:
+		if path[0].elem {
+			return false
+		}
+	case stepElem:
+		if !path[0].elem {
+			return false
+		}
+	}
+
+	return matchPattern(pattern[1:], path[1:])
+}
+
+// walk replaces every value of the tree under path that a rule matches with
+// what convert makes of it. Converted values are not descended into.
+func (m *Mapping) walk(path []pathStep, value interface{}, convert func(c *conversion, value interface{}) (interface{}, error)) (interface{}, error) {
+	if c := m.match(path); c != nil {
+		return convert(c, value)
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, elem := range v {
+			converted, err := m.walk(append(path, pathStep{key: key}), elem, convert)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = converted
+		}
+
+	case map[interface{}]interface{}:
+		// maps with non-string keys come from MessagePack; keys are matched
+		// by the text they take in JSON, so 1 matches the segment "1"
+		for key, elem := range v {
+			keyStr, ok := key.(string)
+			if !ok {
+				text, err := json.Marshal(key)
+				if err != nil {
+					return nil, err
+				}
+				keyStr = string(text)
+			}
+			converted, err := m.walk(append(path, pathStep{key: keyStr}), elem, convert)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = converted
+		}
+
+	case []interface{}:
+		for i, elem := range v {
+			converted, err := m.walk(append(path, pathStep{elem: true}), elem, convert)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = converted
+		}
+	}
+
+	return value, nil
+}
+
+// toMessagePack converts a value decoded from JSON into one the encoder
+// writes in the format the rule asks for. null stays nil.
+func (c *conversion) toMessagePack(value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	switch c.kind {
+	case convBin:
+		s, ok := value.(string)
+		if !ok {
+			return nil, ErrBinaryDataInvalid
+		}
+		return decodeBytes(s, c.encoding)
+
+	case convExt:
+		s, ok := value.(string)
+		if !ok {
+			return nil, ErrBinaryDataInvalid
+		}
+		data, err := decodeBytes(s, c.encoding)
+		if err != nil {
+			return nil, err
+		}
+		return Ext{Type: c.extType, Data: data}, nil
+
+	case convTimestamp:
+		switch v := value.(type) {
+		case string:
+			if c.encoding != "rfc3339" {
+				return nil, ErrTimestampInvalid
+			}
+			t, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return nil, ErrTimestampInvalid
+			}
+			return t, nil
+		case json.Number:
+			if c.encoding != "unix" {
+				return nil, ErrTimestampInvalid
+			}
+			return parseUnix(v)
+		}
+		return nil, ErrTimestampInvalid
+	}
+
+	n, ok := value.(json.Number)
+	if !ok {
+		return nil, ErrUnsupportedType
+	}
+	return c.encodeNumber(n)
+}
+
+// encodeNumber writes n in the integer or float format of the rule. Integer
+// literals are parsed exactly, so 64-bit values keep every digit.
+func (c *conversion) encodeNumber(n json.Number) (rawValue, error) {
+	size := c.bits / 8
+	raw := make(rawValue, 1+size)
+
+	// the 8, 16, 32 and 64 bit formats follow each other
+	sizeIndex := byte(bits.TrailingZeros(uint(size)))
+
+	var payload uint64
+	switch c.kind {
+	case convInt:
+		i, err := strconv.ParseInt(string(n), 10, c.bits)
+		if err != nil {
+			f, ok := integralFloat(n)
+			if !ok || f < -math.Ldexp(1, c.bits-1) || f >= math.Ldexp(1, c.bits-1) {
+				return nil, ErrValueOutOfRange
+			}
+			i = int64(f)
+		}
+		raw[0] = 0xD0 + sizeIndex
+		payload = uint64(i)
+
+	case convUint:
+		u, err := strconv.ParseUint(string(n), 10, c.bits)
+		if err != nil {
+			f, ok := integralFloat(n)
+			if !ok || f < 0 || f >= math.Ldexp(1, c.bits) {
+				return nil, ErrValueOutOfRange
+			}
+			u = uint64(f)
+		}
+		raw[0] = 0xCC + sizeIndex
+		payload = u
+
+	case convFloat:
+		// parsing at the target size rounds the literal only once
+		f, err := strconv.ParseFloat(string(n), c.bits)
+		if err != nil {
+			return nil, ErrValueOutOfRange
+		}
+		if c.bits == 32 {
+			raw[0] = 0xCA
+			payload = uint64(math.Float32bits(float32(f)))
+		} else {
+			raw[0] = 0xCB
+			payload = math.Float64bits(f)
+		}
+	}
+
+	for i := size; i > 0; i-- {
+		raw[i] = byte(payload)
+		payload >>= 8
+	}
+	return raw, nil
+}
+
+// integralFloat parses literals such as 1.0 and 1e3 that name an integer
+// without being written as one.
+func integralFloat(n json.Number) (float64, bool) {
+	f, err := n.Float64()
+	return f, err == nil && f == math.Trunc(f)
+}
+
+// toJSON reverses toMessagePack on a decoded value. Values that are not of
+// the type the rule produces are returned unchanged.
+func (c *conversion) toJSON(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case []byte:
+		if c.kind == convBin {
+			return encodeBytes(v, c.encoding), nil
+		}
+
+	case Ext:
+		if c.kind == convExt && v.Type == c.extType {
+			return encodeBytes(v.Data, c.encoding), nil
+		}
+
+	case time.Time:
+		if c.kind == convTimestamp {
+			if c.encoding == "unix" {
+				return formatUnix(v), nil
+			}
+			return v.Format(time.RFC3339Nano), nil
+		}
+	}
+
+	return value, nil
+}
+
+// parseUnix reads seconds since the epoch from a number literal without
+// going through float64, keeping up to nanosecond precision. Literals with
+// more fractional digits than that, or outside the range of time.Unix,
+// fail with ErrTimestampInvalid.
+func parseUnix(n json.Number) (time.Time, error) {
+	literal := string(n)
+	negative := strings.HasPrefix(literal, "-")
+	literal = strings.TrimPrefix(literal, "-")
+
+	// shift the decimal point by the exponent, which is kept small so the
+	// padding below stays bounded
+	exp := 0
+	if i := strings.IndexAny(literal, "eE"); i >= 0 {
+		var err error
+		if exp, err = strconv.Atoi(literal[i+1:]); err != nil || exp < -30 || exp > 30 {
+			return time.Time{}, ErrTimestampInvalid
+		}
+		literal = literal[:i]
+	}
+	intPart, fracPart, _ := strings.Cut(literal, ".")
+	digits := intPart + fracPart
+	point := len(intPart) + exp
+	if point < 0 {
+		digits = strings.Repeat("0", -point) + digits
+		point = 0
+	}
+	if point > len(digits) {
+		digits += strings.Repeat("0", point-len(digits))
+	}
+
+	secDigits, fracDigits := digits[:point], strings.TrimRight(digits[point:], "0")
+	if len(fracDigits) > 9 {
+		return time.Time{}, ErrTimestampInvalid
+	}
+	if secDigits == "" {
+		secDigits = "0"
+	}
+	sec, err := strconv.ParseInt(secDigits, 10, 64)
+	if err != nil {
+		return time.Time{}, ErrTimestampInvalid
+	}
+	var nsec int64
+	if fracDigits != "" {
+		if nsec, err = strconv.ParseInt(fracDigits+strings.Repeat("0", 9-len(fracDigits)), 10, 64); err != nil {
+			return time.Time{}, ErrTimestampInvalid
+		}
+	}
+
+	if negative {
+		sec = -sec
+		if nsec > 0 {
+			sec, nsec = sec-1, 1e9-nsec
+		}
+	}
+	return time.Unix(sec, nsec).UTC(), nil
+}
+
+// formatUnix writes t as seconds since the epoch, with as many fractional
+// digits as its nanoseconds need.
+func formatUnix(t time.Time) json.Number {
+	sec, nsec := t.Unix(), int64(t.Nanosecond())
+	if nsec == 0 {
+		return json.Number(strconv.FormatInt(sec, 10))
+	}
+
+	sign := ""
+	if sec < 0 {
+		// -1.5 is held as -2 seconds and 500000000 nanoseconds
+		sign, sec, nsec = "-", -(sec + 1), 1e9-nsec
+	}
+	frac := strconv.FormatInt(nsec, 10)
+	frac = strings.TrimRight(strings.Repeat("0", 9-len(frac))+frac, "0")
+	return json.Number(sign + strconv.FormatInt(sec, 10) + "." + frac)
+}
+
+// isMappedValue reports whether v was produced by a rule rather than decoded
+// from JSON, so that BinaryKeyword leaves it alone.
+func isMappedValue(v interface{}) bool {
+	switch v.(type) {
+	case rawValue, []byte, Ext, time.Time:
+		return true
+	}
+	return false
+}
+
+func decodeBytes(s, encoding string) ([]byte, error) {
+	var data []byte
+	var err error
+	if encoding == "hex" {
+		data, err = hex.DecodeString(s)
+	} else {
+		data, err = base64.StdEncoding.DecodeString(s)
+	}
+	if err != nil {
+		return nil, ErrBinaryDataInvalid
+	}
+	return data, nil
+}
+
+func encodeBytes(data []byte, encoding string) string {
+	if encoding == "hex" {
+		return hex.EncodeToString(data)
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
@@ -0,0 +1,261 @@
+package msgpack
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestParseMapping(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    string
+		wantErr error
+	}{
+		{name: "bin", rule: "payload.*.blob -> bin(base64)"},
+		{name: "bin default encoding", rule: "blob -> bin"},
+		{name: "timestamp", rule: "**.created_at -> timestamp(rfc3339)"},
+		{name: "unix timestamp", rule: "at -> timestamp(unix)"},
+		{name: "elements", rule: "ids[] -> uint32"},
+		{name: "root array", rule: "[].id -> int64"},
+		{name: "ext", rule: "raw -> ext(5, hex)"},
+		{name: "float", rule: "ratio -> float32"},
+		{name: "no arrow", rule: "raw ext(5)", wantErr: ErrMappingInvalid},
+		{name: "empty pattern", rule: " -> bin", wantErr: ErrMappingInvalid},
+		{name: "empty segment", rule: "a..b -> bin", wantErr: ErrMappingInvalid},
+		{name: "bracket inside key", rule: "a[]b -> bin", wantErr: ErrMappingInvalid},
+		{name: "elements of any depth", rule: "**[] -> bin", wantErr: ErrMappingInvalid},
+		{name: "unknown conversion", rule: "a -> uint24", wantErr: ErrMappingInvalid},
+		{name: "unknown encoding", rule: "a -> bin(base32)", wantErr: ErrMappingInvalid},
+		{name: "unclosed arguments", rule: "a -> bin(hex", wantErr: ErrMappingInvalid},
+		{name: "ext without type", rule: "a -> ext", wantErr: ErrMappingInvalid},
+		{name: "ext type out of range", rule: "a -> ext(200)", wantErr: ErrMappingInvalid},
+		{name: "arguments to integer", rule: "a -> int8(hex)", wantErr: ErrMappingInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseMapping([]string{tt.rule}); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ParseMapping() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMappingMatch(t *testing.T) {
+	key := func(k string) pathStep { return pathStep{key: k} }
+	elem := pathStep{elem: true}
+
+	tests := []struct {
+		name    string
+		pattern string
+		path    []pathStep
+		matches bool
+	}{
+		{name: "key", pattern: "raw", path: []pathStep{key("raw")}, matches: true},
+		{name: "other key", pattern: "raw", path: []pathStep{key("blob")}},
+		{name: "deeper path", pattern: "raw", path: []pathStep{key("raw"), key("x")}},
+		{name: "any key", pattern: "payload.*.blob", path: []pathStep{key("payload"), key("a"), key("blob")}, matches: true},
+		{name: "any key is not an element", pattern: "payload.*.blob", path: []pathStep{key("payload"), elem, key("blob")}},
+		{name: "any depth at root", pattern: "**.created_at", path: []pathStep{key("created_at")}, matches: true},
+		{name: "any depth", pattern: "**.created_at", path: []pathStep{key("a"), elem, key("created_at")}, matches: true},
+		{name: "elements", pattern: "ids[]", path: []pathStep{key("ids"), elem}, matches: true},
+		{name: "array itself", pattern: "ids[]", path: []pathStep{key("ids")}},
+		{name: "root array", pattern: "[].id", path: []pathStep{elem, key("id")}, matches: true},
+		{name: "nested arrays", pattern: "grid[][]", path: []pathStep{key("grid"), elem, elem}, matches: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := ParseMapping([]string{tt.pattern + " -> bin"})
+			if err != nil {
+				t.Fatalf("ParseMapping() error = %v", err)
+			}
+			if got := m.match(tt.path) != nil; got != tt.matches {
+				t.Errorf("match() = %v, want %v", got, tt.matches)
+			}
+		})
+	}
+}
+
+func TestMappingJSONToMessagePack(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     string
+		input    string
+		expected []byte
+		wantErr  error
+	}{
+		{name: "bin base64", rule: "blob -> bin", input: `{"blob": "AQI="}`, expected: []byte{0x81, 0xA4, 'b', 'l', 'o', 'b', 0xC4, 0x02, 0x01, 0x02}},
+		{name: "bin hex", rule: "blob -> bin(hex)", input: `{"blob": "0102"}`, expected: []byte{0x81, 0xA4, 'b', 'l', 'o', 'b', 0xC4, 0x02, 0x01, 0x02}},
+		{name: "ext", rule: "raw -> ext(5, hex)", input: `{"raw": "01"}`, expected: []byte{0x81, 0xA3, 'r', 'a', 'w', 0xD4, 0x05, 0x01}},
+		{name: "timestamp", rule: "at -> timestamp(rfc3339)", input: `{"at": "1970-01-01T00:00:01Z"}`, expected: []byte{0x81, 0xA2, 'a', 't', 0xD6, 0xFF, 0x00, 0x00, 0x00, 0x01}},
+		{name: "unix timestamp", rule: "at -> timestamp(unix)", input: `{"at": 1}`, expected: []byte{0x81, 0xA2, 'a', 't', 0xD6, 0xFF, 0x00, 0x00, 0x00, 0x01}},
+		{name: "uint32 elements", rule: "ids[] -> uint32", input: `{"ids": [1, 2]}`, expected: []byte{0x81, 0xA3, 'i', 'd', 's', 0x92, 0xCE, 0x00, 0x00, 0x00, 0x01, 0xCE, 0x00, 0x00, 0x00, 0x02}},
+		{name: "int16", rule: "[] -> int16", input: `[-2]`, expected: []byte{0x91, 0xD1, 0xFF, 0xFE}},
+		{name: "uint8", rule: "[] -> uint8", input: `[255]`, expected: []byte{0x91, 0xCC, 0xFF}},
+		{name: "int64", rule: "[] -> int64", input: `[1]`, expected: []byte{0x91, 0xD3, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01}},
+		{name: "uint64 keeps every digit", rule: "[] -> uint64", input: `[18446744073709551615]`, expected: []byte{0x91, 0xCF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}},
+		{name: "integral float literal", rule: "[] -> int8", input: `[-1e1]`, expected: []byte{0x91, 0xD0, 0xF6}},
+		{name: "float32", rule: "[] -> float32", input: `[1]`, expected: []byte{0x91, 0xCA, 0x3F, 0x80, 0x00, 0x00}},
+		{name: "float64", rule: "[] -> float64", input: `[1]`, expected: []byte{0x91, 0xCB, 0x3F, 0xF0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		{name: "null stays nil", rule: "blob -> bin", input: `{"blob": null}`, expected: []byte{0x81, 0xA4, 'b', 'l', 'o', 'b', 0xC0}},
+		{name: "int8 out of range", rule: "[] -> int8", input: `[128]`, wantErr: ErrValueOutOfRange},
+		{name: "negative uint", rule: "[] -> uint16", input: `[-1]`, wantErr: ErrValueOutOfRange},
+		{name: "fractional int", rule: "[] -> int32", input: `[1.5]`, wantErr: ErrValueOutOfRange},
+		{name: "float32 overflow", rule: "[] -> float32", input: `[1e300]`, wantErr: ErrValueOutOfRange},
+		{name: "number from string", rule: "[] -> uint8", input: `["1"]`, wantErr: ErrUnsupportedType},
+		{name: "invalid base64", rule: "blob -> bin", input: `{"blob": "!"}`, wantErr: ErrBinaryDataInvalid},
+		{name: "invalid timestamp", rule: "at -> timestamp", input: `{"at": "yesterday"}`, wantErr: ErrTimestampInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapping, err := ParseMapping([]string{tt.rule})
+			if err != nil {
+				t.Fatalf("ParseMapping() error = %v", err)
+			}
+
+			got, err := Options{Mapping: mapping}.JSONToMessagePack([]byte(tt.input))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("JSONToMessagePack() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !bytes.Equal(got, tt.expected) {
+				t.Errorf("JSONToMessagePack() = % X, want % X", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMappingRoundTrip(t *testing.T) {
+	mapping, err := ParseMapping([]string{
+		"payload.*.blob -> bin(base64)",
+		"**.created_at -> timestamp(rfc3339)",
+		"ids[] -> uint32",
+		"raw -> ext(5, hex)",
+		"ratio -> float32",
+	})
+	if err != nil {
+		t.Fatalf("ParseMapping() error = %v", err)
+	}
+	opts := Options{Mapping: mapping, BinaryKeyword: "raw", Encoder: EncoderOptions{Canonical: true}}
+
+	input := `{"created_at":"2024-07-24T10:00:00.5Z","ids":[1,70000],"payload":{"a":{"blob":"AQI=","created_at":"2024-07-24T10:00:00Z"}},"ratio":0.5,"raw":"cafe"}`
+
+	encoded, err := opts.JSONToMessagePack([]byte(input))
+	if err != nil {
+		t.Fatalf("JSONToMessagePack() error = %v", err)
+	}
+
+	got, err := opts.MessagePackToJSON(encoded)
+	if err != nil {
+		t.Fatalf("MessagePackToJSON() error = %v", err)
+	}
+	if got != input {
+		t.Errorf("MessagePackToJSON() = %s, want %s", got, input)
+	}
+}
+
+func TestMappingMessagePackToJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     string
+		input    []byte
+		expected string
+	}{
+		{name: "under an int key", rule: "1.blob -> bin(hex)", input: []byte{0x81, 0x01, 0x81, 0xA4, 'b', 'l', 'o', 'b', 0xC4, 0x02, 0x01, 0x02}, expected: `{"1":{"blob":"0102"}}`},
+		{name: "any key matches an int key", rule: "*.blob -> bin(hex)", input: []byte{0x81, 0xFF, 0x81, 0xA4, 'b', 'l', 'o', 'b', 0xC4, 0x01, 0x01}, expected: `{"-1":{"blob":"01"}}`},
+		{name: "int key itself", rule: "2 -> bin(hex)", input: []byte{0x81, 0x02, 0xC4, 0x01, 0xFF}, expected: `{"2":"ff"}`},
+		{name: "timestamp in UTC", rule: "at -> timestamp", input: []byte{0x81, 0xA2, 'a', 't', 0xD6, 0xFF, 0x65, 0x92, 0x8D, 0x20}, expected: `{"at":"2024-01-01T10:00:00Z"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapping, err := ParseMapping([]string{tt.rule})
+			if err != nil {
+				t.Fatalf("ParseMapping() error = %v", err)
+			}
+			opts := Options{Mapping: mapping}
+
+			got, err := opts.MessagePackToJSON(tt.input)
+			if err != nil {
+				t.Fatalf("MessagePackToJSON() error = %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("MessagePackToJSON() = %s, want %s", got, tt.expected)
+			}
+
+			var buf bytes.Buffer
+			if err := opts.TranscodeToJSON(&buf, bytes.NewReader(tt.input)); err != nil {
+				t.Fatalf("TranscodeToJSON() error = %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("TranscodeToJSON() = %s, want %s", buf.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestMappingTimestampOffset(t *testing.T) {
+	mapping, err := ParseMapping([]string{"at -> timestamp(rfc3339)"})
+	if err != nil {
+		t.Fatalf("ParseMapping() error = %v", err)
+	}
+	opts := Options{Mapping: mapping}
+
+	encoded, err := opts.JSONToMessagePack([]byte(`{"at":"2024-01-01T10:00:00+02:00"}`))
+	if err != nil {
+		t.Fatalf("JSONToMessagePack() error = %v", err)
+	}
+	got, err := opts.MessagePackToJSON(encoded)
+	if err != nil {
+		t.Fatalf("MessagePackToJSON() error = %v", err)
+	}
+	if want := `{"at":"2024-01-01T08:00:00Z"}`; got != want {
+		t.Errorf("MessagePackToJSON() = %s, want %s", got, want)
+	}
+}
+
+func TestMappingUnixTimestamp(t *testing.T) {
+	mapping, err := ParseMapping([]string{"t -> timestamp(unix)"})
+	if err != nil {
+		t.Fatalf("ParseMapping() error = %v", err)
+	}
+	opts := Options{Mapping: mapping}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		wantErr  error
+	}{
+		{name: "nanoseconds", input: `{"t":1721815200.123456789}`},
+		{name: "seconds", input: `{"t":1721815200}`},
+		{name: "negative", input: `{"t":-1.5}`},
+		{name: "before 1678", input: `{"t":-10000000000.000000001}`},
+		{name: "after 2262", input: `{"t":10000000000.25}`},
+		{name: "exponent", input: `{"t":1.5e3}`, expected: `{"t":1500}`},
+		{name: "trailing zeros", input: `{"t":1.100}`, expected: `{"t":1.1}`},
+		{name: "below a nanosecond", input: `{"t":1.0000000001}`, wantErr: ErrTimestampInvalid},
+		{name: "too large", input: `{"t":1e30}`, wantErr: ErrTimestampInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := opts.JSONToMessagePack([]byte(tt.input))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("JSONToMessagePack() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			got, err := opts.MessagePackToJSON(encoded)
+			if err != nil {
+				t.Fatalf("MessagePackToJSON() error = %v", err)
+			}
+			expected := tt.expected
+			if expected == "" {
+				expected = tt.input
+			}
+			if got != expected {
+				t.Errorf("MessagePackToJSON() = %s, want %s", got, expected)
+			}
+		})
+	}
+}
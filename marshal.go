@@ -0,0 +1,254 @@
+package msgpack
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"time"
+)
+
+var (
+	extType        = reflect.TypeOf(Ext{})
+	timeType       = reflect.TypeOf(time.Time{})
+	jsonNumberType = reflect.TypeOf(json.Number(""))
+)
+
+// Marshal returns the MessagePack encoding of v.
+//
+// Byte slices and arrays are encoded as bin, and json.Number values as the
+// number they hold. Maps may be keyed by strings, numbers, bools or
+// interfaces holding those. Structs are encoded as maps keyed by field name.
+// The `msgpack` struct tag overrides the name, "-" skips the field and the
+// "omitempty" option drops zero values. Pointers and interfaces encode the
+// value they point to, or nil.
+func Marshal(v interface{}) ([]byte, error) {
+	return Options{}.Marshal(v)
+}
+
+// Marshal is like the package-level Marshal but encodes with o.Encoder.
+func (o Options) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := newEncodeState(&buf, o.Encoder).encodeValue(reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (es *encodeState) encodeValue(value reflect.Value) error {
+	buf := es.buf
+
+	if !value.IsValid() {
+		return encodeNil(buf, nil)
+	}
+	es.traceType("encode", value.Type())
+
+	switch value.Type() {
+	case extType:
+		return encodeExt(buf, int8(value.Field(0).Int()), value.Field(1).Bytes())
+
+	case timeType:
+		return encodeTimestamp(buf, value.Interface().(time.Time))
+
+	case jsonNumberType:
+		return es.encodeJSONNumber(json.Number(value.String()))
+	}
+
+	if entry := es.lookupExtType(value.Type()); entry != nil {
+		return es.encodeRegisteredExt(entry, value.Interface())
+	}
+
+	switch value.Kind() {
+	case reflect.Bool:
+		return encodeBool(buf, value.Bool())
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return es.encodeInt64(value.Int())
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return encodeUint(buf, value.Uint())
+
+	case reflect.Float32:
+		return es.encodeFloat32(float32(value.Float()))
+
+	case reflect.Float64:
+		return es.encodeFloat64(value.Float())
+
+	case reflect.String:
+		return encodeString(buf, value.String())
+
+	case reflect.Slice:
+		if value.IsNil() {
+			return encodeNil(buf, nil)
+		}
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			return encodeBin(buf, value.Bytes())
+		}
+		return es.encodeArrayValue(value)
+
+	case reflect.Array:
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			data := make([]byte, value.Len())
+			reflect.Copy(reflect.ValueOf(data), value)
+			return encodeBin(buf, data)
+		}
+		return es.encodeArrayValue(value)
+
+	case reflect.Map:
+		if value.IsNil() {
+			return encodeNil(buf, nil)
+		}
+		return es.encodeMapValue(value)
+
+	case reflect.Struct:
+		return es.encodeStructValue(value)
+
+	case reflect.Pointer, reflect.Interface:
+		if value.IsNil() {
+			return encodeNil(buf, nil)
+		}
+		return es.encodeValue(value.Elem())
+
+	default:
+		return ErrUnsupportedType
+	}
+}
+
+func (es *encodeState) encodeArrayValue(value reflect.Value) error {
+	buf := es.buf
+
+	length := value.Len()
+
+	if err := encodeArrayHeader(buf, length); err != nil {
+		return err
+	}
+
+	for i := 0; i < length; i++ {
+		if err := es.encodeValue(value.Index(i)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (es *encodeState) encodeMapValue(value reflect.Value) error {
+	buf := es.buf
+
+	switch value.Type().Key().Kind() {
+	case reflect.String:
+
+	case reflect.Bool, reflect.Interface,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return es.encodeAnyKeyMapValue(value)
+
+	default:
+		return ErrUnsupportedType
+	}
+
+	if err := encodeMapHeader(buf, value.Len()); err != nil {
+		return err
+	}
+
+	keys := value.MapKeys()
+	if es.opts.Canonical {
+		sort.Slice(keys, func(i, j int) bool {
+			return canonicalStringLess(keys[i].String(), keys[j].String())
+		})
+	}
+
+	for _, key := range keys {
+		if err := encodeString(buf, key.String()); err != nil {
+			return err
+		}
+
+		if err := es.encodeValue(value.MapIndex(key)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// encodeAnyKeyMapValue encodes maps keyed by numbers, bools or interfaces.
+// Keys are encoded like any other value.
+func (es *encodeState) encodeAnyKeyMapValue(value reflect.Value) error {
+	if err := encodeMapHeader(es.buf, value.Len()); err != nil {
+		return err
+	}
+
+	keys := value.MapKeys()
+
+	if !es.opts.Canonical {
+		for _, key := range keys {
+			if err := es.encodeValue(key); err != nil {
+				return err
+			}
+			if err := es.encodeValue(value.MapIndex(key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	encodedKeys, order, err := es.sortEncodedKeys(len(keys), func(kes *encodeState, i int) error {
+		return kes.encodeValue(keys[i])
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, i := range order {
+		if _, err := es.buf.Write(encodedKeys[i]); err != nil {
+			return err
+		}
+		if err := es.encodeValue(value.MapIndex(keys[i])); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (es *encodeState) encodeStructValue(value reflect.Value) error {
+	buf := es.buf
+
+	fields := cachedFields(value.Type())
+	if es.opts.Canonical {
+		fields = canonicalFields(value.Type())
+	}
+
+	values := make([]reflect.Value, len(fields))
+	length := 0
+	for i, f := range fields {
+		fv, ok := fieldByIndex(value, f.index)
+		if !ok || (f.omitEmpty && isEmptyValue(fv)) {
+			continue
+		}
+		values[i] = fv
+		length++
+	}
+
+	if err := encodeMapHeader(buf, length); err != nil {
+		return err
+	}
+
+	for i, f := range fields {
+		if !values[i].IsValid() {
+			continue
+		}
+
+		if err := encodeString(buf, f.name); err != nil {
+			return err
+		}
+
+		if err := es.encodeValue(values[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,162 @@
+package msgpack
+
+import (
+	"bytes"
+	"testing"
+)
+
+type testPoint struct {
+	X int `msgpack:"x"`
+	Y int `msgpack:"y,omitempty"`
+}
+
+type testEmbedded struct {
+	ID string `msgpack:"id"`
+}
+
+type testRecord struct {
+	testEmbedded
+	Name     string            `msgpack:"name"`
+	Tags     []string          `msgpack:"tags,omitempty"`
+	Point    *testPoint        `msgpack:"point"`
+	Attrs    map[string]uint16 `msgpack:"attrs,omitempty"`
+	Ignored  string            `msgpack:"-"`
+	internal int
+}
+
+func TestMarshal(t *testing.T) {
+	name := "ptr"
+
+	tests := []struct {
+		name    string
+		value   interface{}
+		encoded []byte
+		wantErr error
+	}{
+		{name: "nil", value: nil, encoded: []byte{0xC0}},
+		{name: "int8", value: int8(-5), encoded: []byte{0xFB}},
+		{name: "uint16", value: uint16(300), encoded: []byte{0xCD, 0x01, 0x2C}},
+		{name: "float32", value: float32(1.0), encoded: []byte{0xCA, 0x3F, 0x80, 0x00, 0x00}},
+		{name: "string pointer", value: &name, encoded: []byte{0xA3, 'p', 't', 'r'}},
+		{name: "nil pointer", value: (*testPoint)(nil), encoded: []byte{0xC0}},
+		{name: "typed slice", value: []int{1, 2, 3}, encoded: []byte{0x93, 0x01, 0x02, 0x03}},
+		{name: "nil slice", value: []string(nil), encoded: []byte{0xC0}},
+		{name: "array", value: [2]bool{true, false}, encoded: []byte{0x92, 0xC3, 0xC2}},
+		{name: "byte slice", value: []byte{0x01, 0x02}, encoded: []byte{0xC4, 0x02, 0x01, 0x02}},
+		{name: "byte array", value: [3]byte{0x01, 0x02, 0x03}, encoded: []byte{0xC4, 0x03, 0x01, 0x02, 0x03}},
+		{name: "nested byte slice", value: map[string]interface{}{"b": []byte{}}, encoded: []byte{0x81, 0xA1, 'b', 0xC4, 0x00}},
+		{name: "typed map", value: map[string]int{"a": 1}, encoded: []byte{0x81, 0xA1, 'a', 0x01}},
+		{name: "struct", value: testPoint{X: 1, Y: 2}, encoded: []byte{0x82, 0xA1, 'x', 0x01, 0xA1, 'y', 0x02}},
+		{name: "struct omitempty", value: testPoint{X: 1}, encoded: []byte{0x81, 0xA1, 'x', 0x01}},
+		{name: "unsupported kind", value: make(chan int), wantErr: ErrUnsupportedType},
+		{name: "int map", value: map[int]string{-1: "a"}, encoded: []byte{0x81, 0xFF, 0xA1, 'a'}},
+		{name: "uint64 map", value: map[uint64]bool{300: true}, encoded: []byte{0x81, 0xCD, 0x01, 0x2C, 0xC3}},
+		{name: "bool map", value: map[bool]int{true: 1}, encoded: []byte{0x81, 0xC3, 0x01}},
+		{name: "interface map", value: map[interface{}]interface{}{1.5: nil}, encoded: []byte{0x81, 0xCA, 0x3F, 0xC0, 0x00, 0x00, 0xC0}},
+		{name: "unsupported key", value: map[testPoint]int{{}: 1}, wantErr: ErrUnsupportedType},
+		{name: "unsupported interface key", value: map[interface{}]int{make(chan int): 1}, wantErr: ErrUnsupportedType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Marshal(tt.value)
+			if err != tt.wantErr {
+				t.Fatalf("Marshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && !bytes.Equal(got, tt.encoded) {
+				t.Errorf("Marshal() = % X, want % X", got, tt.encoded)
+			}
+		})
+	}
+}
+
+func TestMarshalStruct(t *testing.T) {
+	record := testRecord{
+		testEmbedded: testEmbedded{ID: "r1"},
+		Name:         "record",
+		Point:        &testPoint{X: 3},
+		Ignored:      "ignored",
+		internal:     7,
+	}
+
+	encoded, err := Marshal(record)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	result, err := NewMessagePackDecoder(encoded).Decode()
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"id":    "r1",
+		"name":  "record",
+		"point": map[string]interface{}{"x": uint8(3)},
+	}
+	if !isEqual(result, expected) {
+		t.Errorf("Decode() = %v, want %v", result, expected)
+	}
+}
+
+type testNameA struct {
+	Name string
+	A    int
+}
+
+type testNameB struct {
+	Name string
+	B    int
+}
+
+type testNameTagged struct {
+	Label string `msgpack:"Name"`
+}
+
+func TestMarshalDuplicateFieldNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    interface{}
+		expected map[string]interface{}
+	}{
+		{
+			name: "untagged at the same depth are dropped",
+			value: struct {
+				testNameA
+				testNameB
+			}{testNameA{Name: "a", A: 1}, testNameB{Name: "b", B: 2}},
+			expected: map[string]interface{}{"A": uint8(1), "B": uint8(2)},
+		},
+		{
+			name: "tagged one wins",
+			value: struct {
+				testNameA
+				testNameTagged
+			}{testNameA{Name: "a", A: 1}, testNameTagged{Label: "t"}},
+			expected: map[string]interface{}{"Name": "t", "A": uint8(1)},
+		},
+		{
+			name: "shallower one wins",
+			value: struct {
+				testNameA
+				testNameB
+				Name string
+			}{testNameA{Name: "a"}, testNameB{Name: "b"}, "outer"},
+			expected: map[string]interface{}{"Name": "outer", "A": uint8(0), "B": uint8(0)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := Marshal(tt.value)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			result, err := NewMessagePackDecoder(encoded).Decode()
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !isEqual(result, tt.expected) {
+				t.Errorf("Decode() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
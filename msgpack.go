@@ -3,41 +3,116 @@ package msgpack
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
+	"io"
+	"strings"
 )
 
+// JSONToMessagePack converts a JSON document to MessagePack with the zero
+// Options.
 func JSONToMessagePack(jsonData []byte) ([]byte, error) {
-	tag := "[JSONToMessagePack]"
+	return Options{}.JSONToMessagePack(jsonData)
+}
 
-	var data interface{}
-	if err := json.Unmarshal(jsonData, &data); err != nil {
-		fmt.Printf("%v Unmarshal failed, err: %v\n", tag, err)
+// JSONToMessagePack converts a JSON document to MessagePack. Values matched
+// by o.Mapping are converted by its rules, and base64 strings under
+// o.BinaryKeyword are written as bin. With o.TypedJSON the document is read
+// as typed JSON instead.
+func (o Options) JSONToMessagePack(jsonData []byte) ([]byte, error) {
+	if o.TypedJSON {
+		var buf bytes.Buffer
+		if err := o.readTypedJSON(&buf, bytes.NewReader(jsonData)); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	data, err := unmarshalJSON(jsonData)
+	if err != nil {
 		return nil, err
 	}
 
+	if o.Mapping != nil {
+		if data, err = o.Mapping.walk(nil, data, (*conversion).toMessagePack); err != nil {
+			return nil, err
+		}
+	}
+
 	var buf bytes.Buffer
-	if err := encode(&buf, data); err != nil {
-		fmt.Printf("%v encode failed, err: %v\n", tag, err)
+	if err := o.newBridgeEncodeState(&buf).encode(data); err != nil {
 		return nil, err
 	}
 
 	return buf.Bytes(), nil
 }
 
+// newBridgeEncodeState returns an encodeState for the JSON bridge, writing
+// to buf with o.Encoder and the bridge settings of o.
+func (o Options) newBridgeEncodeState(buf writer) *encodeState {
+	es := newEncodeState(buf, o.Encoder)
+	es.binaryKeyword = o.BinaryKeyword
+	es.bigInt = o.BigInt
+	es.numbers = o.Numbers
+	es.float32Tolerance = o.Float32Tolerance
+	return es
+}
+
+// unmarshalJSON decodes a JSON document with numbers kept as json.Number, so
+// integers are not rounded to float64 on the way.
+func unmarshalJSON(jsonData []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(jsonData))
+	dec.UseNumber()
+
+	var data interface{}
+	if err := dec.Decode(&data); err != nil {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		if err == nil {
+			return nil, ErrTrailingData
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// MessagePackToJSON converts a MessagePack value to JSON with the zero
+// Options.
 func MessagePackToJSON(mp []byte) (string, error) {
-	tag := "[MessagePackToJSON]"
+	return Options{}.MessagePackToJSON(mp)
+}
+
+// MessagePackToJSON converts a MessagePack value to JSON, decoding it with
+// o.Decoder. Values matched by o.Mapping are turned back into the JSON form
+// its rules read. With o.TypedJSON the value is written as typed JSON.
+func (o Options) MessagePackToJSON(mp []byte) (string, error) {
+	if o.TypedJSON {
+		o.JSON = JSONOptions{}
+		var sb strings.Builder
+		if err := o.TranscodeToJSON(&sb, bytes.NewReader(mp)); err != nil {
+			return "", err
+		}
+		return sb.String(), nil
+	}
 
-	decoder := NewMessagePackDecoder(mp)
+	decoder := NewDecoderWithOptions(bytes.NewReader(mp), o.Decoder)
 
 	data, err := decoder.Decode()
 	if err != nil {
-		fmt.Printf("%v Decode failed, err: %v", tag, err)
 		return "", err
 	}
 
+	if o.Mapping != nil {
+		if data, err = o.Mapping.walk(nil, data, (*conversion).toJSON); err != nil {
+			return "", err
+		}
+	}
+
 	jsonData, err := json.Marshal(data)
 	if err != nil {
-		fmt.Printf("%v Marshal failed, err: %v", tag, err)
 		return "", err
 	}
 	return string(jsonData), nil
@@ -0,0 +1,219 @@
+package msgpack
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestJSONToMessagePackBinaryKeyword(t *testing.T) {
+	opts := Options{BinaryKeyword: "binary_data"}
+
+	got, err := opts.JSONToMessagePack([]byte(`{"binary_data": "AQI="}`))
+	if err != nil {
+		t.Fatalf("JSONToMessagePack() error = %v", err)
+	}
+
+	expected := []byte{0x81, 0xAB, 'b', 'i', 'n', 'a', 'r', 'y', '_', 'd', 'a', 't', 'a', 0xC4, 0x02, 0x01, 0x02}
+	if !bytes.Equal(got, expected) {
+		t.Errorf("JSONToMessagePack() = % X, want % X", got, expected)
+	}
+
+	// outside the JSON bridge the keyword has no special meaning
+	var buf bytes.Buffer
+	if err := encode(&buf, map[string]interface{}{"binary_data": "AQI="}); err != nil {
+		t.Fatalf("encode() error = %v", err)
+	}
+	if buf.Bytes()[13] != 0xA4 {
+		t.Errorf("encode() = % X, want the value as a string", buf.Bytes())
+	}
+
+	// nor without one
+	got, err = JSONToMessagePack([]byte(`{"binary_data": "AQI="}`))
+	if err != nil {
+		t.Fatalf("JSONToMessagePack() error = %v", err)
+	}
+	if got[13] != 0xA4 {
+		t.Errorf("JSONToMessagePack() = % X, want the value as a string", got)
+	}
+}
+
+func TestOptionsConcurrent(t *testing.T) {
+	input := []byte(`{"a": "AQI=", "b": "AQI="}`)
+	tests := []struct {
+		opts     Options
+		expected []byte
+	}{
+		{opts: Options{BinaryKeyword: "a", Encoder: EncoderOptions{Canonical: true}}, expected: []byte{0x82, 0xA1, 'a', 0xC4, 0x02, 0x01, 0x02, 0xA1, 'b', 0xA4, 'A', 'Q', 'I', '='}},
+		{opts: Options{BinaryKeyword: "b", Encoder: EncoderOptions{Canonical: true}}, expected: []byte{0x82, 0xA1, 'a', 0xA4, 'A', 'Q', 'I', '=', 0xA1, 'b', 0xC4, 0x02, 0x01, 0x02}},
+	}
+
+	var wg sync.WaitGroup
+	for _, tt := range tests {
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				got, err := tt.opts.JSONToMessagePack(input)
+				if err != nil {
+					t.Errorf("JSONToMessagePack() error = %v", err)
+					return
+				}
+				if !bytes.Equal(got, tt.expected) {
+					t.Errorf("JSONToMessagePack() = % X, want % X", got, tt.expected)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+}
+
+func TestOptionsDecoder(t *testing.T) {
+	opts := Options{Decoder: DecoderOptions{MaxContainerLen: 1}}
+	input := []byte{0x92, 0x01, 0x02}
+
+	var v []int
+	if err := opts.Unmarshal(input, &v); !errors.Is(err, ErrMaxContainerLenExceeded) {
+		t.Errorf("Unmarshal() error = %v, wantErr %v", err, ErrMaxContainerLenExceeded)
+	}
+	if _, err := opts.MessagePackToJSON(input); !errors.Is(err, ErrMaxContainerLenExceeded) {
+		t.Errorf("MessagePackToJSON() error = %v, wantErr %v", err, ErrMaxContainerLenExceeded)
+	}
+	if _, err := opts.NewDecoder(bytes.NewReader(input)).Decode(); !errors.Is(err, ErrMaxContainerLenExceeded) {
+		t.Errorf("Decode() error = %v, wantErr %v", err, ErrMaxContainerLenExceeded)
+	}
+
+	if err := Unmarshal(input, &v); err != nil {
+		t.Errorf("Unmarshal() error = %v", err)
+	}
+}
+
+func TestOptionsEncoder(t *testing.T) {
+	opts := Options{Encoder: EncoderOptions{Canonical: true}}
+	value := map[string]int{"bb": 1, "a": 2}
+	expected := []byte{0x82, 0xA1, 'a', 0x02, 0xA2, 'b', 'b', 0x01}
+
+	got, err := opts.Marshal(value)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if !bytes.Equal(got, expected) {
+		t.Errorf("Marshal() = % X, want % X", got, expected)
+	}
+
+	var out bytes.Buffer
+	if err := opts.NewEncoder(&out).Encode(value); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), expected) {
+		t.Errorf("Encode() = % X, want % X", out.Bytes(), expected)
+	}
+}
+
+func TestJSONToMessagePackNumbers(t *testing.T) {
+	tests := []struct {
+		name     string
+		bigInt   BigIntFormat
+		input    string
+		expected []byte
+		wantErr  error
+	}{
+		{name: "beyond float64 precision", input: `9007199254740993`, expected: []byte{0xCF, 0x00, 0x20, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01}},
+		{name: "max uint64", input: `18446744073709551615`, expected: []byte{0xCF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}},
+		{name: "min int64", input: `-9223372036854775808`, expected: []byte{0xD3, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		{name: "negative", input: `-1`, expected: []byte{0xFF}},
+		{name: "integral float", input: `1.0`, expected: []byte{0x01}},
+		{name: "integral exponent", input: `1e19`, expected: []byte{0xCF, 0x8A, 0xC7, 0x23, 0x04, 0x89, 0xE8, 0x00, 0x00}},
+		{name: "float32", input: `1.5`, expected: []byte{0xCA, 0x3F, 0xC0, 0x00, 0x00}},
+		{name: "float64", input: `0.1`, expected: []byte{0xCB, 0x3F, 0xB9, 0x99, 0x99, 0x99, 0x99, 0x99, 0x9A}},
+		{name: "beyond uint64", input: `18446744073709551616`, wantErr: ErrValueOutOfRange},
+		{name: "beyond int64", input: `-9223372036854775809`, wantErr: ErrValueOutOfRange},
+		{name: "beyond float64", input: `1e400`, wantErr: ErrValueOutOfRange},
+		{name: "big int as float", bigInt: BigIntFloat, input: `18446744073709551616`, expected: []byte{0xCA, 0x5F, 0x80, 0x00, 0x00}},
+		{name: "big int as string", bigInt: BigIntString, input: `-9223372036854775809`, expected: append([]byte{0xB4}, "-9223372036854775809"...)},
+		{name: "trailing data", input: `1 2`, wantErr: ErrTrailingData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Options{BigInt: tt.bigInt}
+
+			got, err := opts.JSONToMessagePack([]byte(tt.input))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("JSONToMessagePack() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !bytes.Equal(got, tt.expected) {
+				t.Errorf("JSONToMessagePack() = % X, want % X", got, tt.expected)
+			}
+
+			var buf bytes.Buffer
+			err = opts.TranscodeJSON(&buf, strings.NewReader(tt.input))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("TranscodeJSON() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && !bytes.Equal(buf.Bytes(), tt.expected) {
+				t.Errorf("TranscodeJSON() = % X, want % X", buf.Bytes(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestJSONToMessagePackNumberPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     Options
+		input    string
+		expected []byte
+	}{
+		{name: "smallest integral float", input: `1.0`, expected: []byte{0x01}},
+		{name: "smallest float32", input: `1.5`, expected: []byte{0xCA, 0x3F, 0xC0, 0x00, 0x00}},
+		{name: "smallest negative zero", input: `-0.0`, expected: []byte{0xCA, 0x80, 0x00, 0x00, 0x00}},
+		{name: "smallest negative zero integer", input: `-0`, expected: []byte{0xCA, 0x80, 0x00, 0x00, 0x00}},
+		{name: "smallest positive zero", input: `0.0`, expected: []byte{0x00}},
+		{name: "literal negative zero integer", opts: Options{Numbers: NumbersLiteral}, input: `-0`, expected: []byte{0x00}},
+		{name: "literal integer", opts: Options{Numbers: NumbersLiteral}, input: `1`, expected: []byte{0x01}},
+		{name: "literal integral float", opts: Options{Numbers: NumbersLiteral}, input: `1.0`, expected: []byte{0xCA, 0x3F, 0x80, 0x00, 0x00}},
+		{name: "literal exponent", opts: Options{Numbers: NumbersLiteral}, input: `1e3`, expected: []byte{0xCA, 0x44, 0x7A, 0x00, 0x00}},
+		{name: "literal float64", opts: Options{Numbers: NumbersLiteral}, input: `0.1`, expected: []byte{0xCB, 0x3F, 0xB9, 0x99, 0x99, 0x99, 0x99, 0x99, 0x9A}},
+		{name: "float64 integer", opts: Options{Numbers: NumbersFloat64}, input: `1`, expected: []byte{0xCB, 0x3F, 0xF0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		{name: "float64 never narrows", opts: Options{Numbers: NumbersFloat64, Float32Tolerance: 1e-7}, input: `1.5`, expected: []byte{0xCB, 0x3F, 0xF8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		{name: "tolerance narrows", opts: Options{Float32Tolerance: 1e-7}, input: `0.1`, expected: []byte{0xCA, 0x3D, 0xCC, 0xCC, 0xCD}},
+		{name: "tolerance with literal", opts: Options{Numbers: NumbersLiteral, Float32Tolerance: 1e-7}, input: `0.1`, expected: []byte{0xCA, 0x3D, 0xCC, 0xCC, 0xCD}},
+		{name: "tolerance exceeded", opts: Options{Float32Tolerance: 1e-9}, input: `0.1`, expected: []byte{0xCB, 0x3F, 0xB9, 0x99, 0x99, 0x99, 0x99, 0x99, 0x9A}},
+		{name: "beyond float32 range", opts: Options{Float32Tolerance: 1}, input: `1.5e300`, expected: []byte{0xCB, 0x7E, 0x41, 0xEB, 0x2D, 0x66, 0x00, 0x58, 0x35}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.opts.JSONToMessagePack([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("JSONToMessagePack() error = %v", err)
+			}
+			if !bytes.Equal(got, tt.expected) {
+				t.Errorf("JSONToMessagePack() = % X, want % X", got, tt.expected)
+			}
+
+			var buf bytes.Buffer
+			if err := tt.opts.TranscodeJSON(&buf, strings.NewReader(tt.input)); err != nil {
+				t.Fatalf("TranscodeJSON() error = %v", err)
+			}
+			if !bytes.Equal(buf.Bytes(), tt.expected) {
+				t.Errorf("TranscodeJSON() = % X, want % X", buf.Bytes(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestJSONNegativeZeroRoundTrip(t *testing.T) {
+	mp, err := JSONToMessagePack([]byte(`[-0.0,-0,0]`))
+	if err != nil {
+		t.Fatalf("JSONToMessagePack() error = %v", err)
+	}
+	js, err := MessagePackToJSON(mp)
+	if err != nil {
+		t.Fatalf("MessagePackToJSON() error = %v", err)
+	}
+	if js != `[-0,-0,0]` {
+		t.Errorf("MessagePackToJSON() = %s, want [-0,-0,0]", js)
+	}
+}
@@ -0,0 +1,95 @@
+package msgpack
+
+import "io"
+
+// Options configures the package as a whole: the JSON bridge and the
+// encoders and decoders it hands out. The zero value is ready to use and
+// behaves like the package-level functions.
+//
+// Options is only ever read, so one value may be shared by any number of
+// goroutines, and callers in the same process can each use their own.
+type Options struct {
+	// BinaryKeyword names the map key whose base64 string values
+	// JSONToMessagePack writes as bin. Empty disables it.
+	BinaryKeyword string
+
+	// BigInt selects what the JSON bridge does with integers that do not
+	// fit 64 bits.
+	BigInt BigIntFormat
+
+	// Numbers selects the formats the JSON bridge writes numbers in.
+	Numbers NumberPolicy
+
+	// Float32Tolerance lets the JSON bridge narrow a float to float 32 when
+	// that changes it by at most this fraction of its value, as 1e-7 would
+	// for a float 32 rounding. Zero narrows only when nothing is lost.
+	// NumbersFloat64 never narrows.
+	Float32Tolerance float64
+
+	// Mapping holds the rules the JSON bridge converts values by, in both
+	// directions. Its rules take precedence over BinaryKeyword.
+	Mapping *Mapping
+
+	// TypedJSON switches the JSON bridge to typed JSON, which records the
+	// MessagePack format of every value JSON cannot tell apart, so that
+	// MessagePack converted to JSON and back is byte for byte the same. It
+	// replaces BinaryKeyword, Numbers, Float32Tolerance, Mapping and the
+	// Bin, NonFinite and NonStringKeys settings of JSON.
+	TypedJSON bool
+
+	// Encoder configures Marshal, NewEncoder and the encoding half of the
+	// JSON bridge.
+	Encoder EncoderOptions
+
+	// Decoder configures Unmarshal, NewDecoder and the decoding half of the
+	// JSON bridge.
+	Decoder DecoderOptions
+
+	// JSON configures the JSON TranscodeToJSON writes.
+	JSON JSONOptions
+}
+
+// NewEncoder returns an encoder writing to w with o.Encoder.
+func (o Options) NewEncoder(w io.Writer) *Encoder {
+	return NewEncoderWithOptions(w, o.Encoder)
+}
+
+// NewDecoder returns a decoder reading from r with o.Decoder.
+func (o Options) NewDecoder(r io.Reader) *MessagePackDecoder {
+	return NewDecoderWithOptions(r, o.Decoder)
+}
+
+// BigIntFormat is what the JSON bridge writes for integer literals beyond
+// the range of int64 and uint64.
+type BigIntFormat int
+
+const (
+	// BigIntError fails with ErrValueOutOfRange.
+	BigIntError BigIntFormat = iota
+
+	// BigIntFloat writes the nearest float64.
+	BigIntFloat
+
+	// BigIntString writes the digits as a string.
+	BigIntString
+)
+
+// NumberPolicy is how the JSON bridge chooses MessagePack formats for JSON
+// numbers, which carry no type of their own.
+type NumberPolicy int
+
+const (
+	// NumbersSmallest writes integral values, 1.0 included, as the smallest
+	// int or uint holding them, and other values as float 32 when that is
+	// lossless, float 64 otherwise. Negative zero stays a float to keep its
+	// sign.
+	NumbersSmallest NumberPolicy = iota
+
+	// NumbersLiteral follows the literal: numbers written with a decimal
+	// point or exponent are floats, narrowed as in NumbersSmallest, and the
+	// rest are ints or uints.
+	NumbersLiteral
+
+	// NumbersFloat64 writes every number as float 64.
+	NumbersFloat64
+)
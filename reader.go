@@ -0,0 +1,260 @@
+package msgpack
+
+import (
+	"io"
+	"reflect"
+)
+
+// Reader reads MessagePack one header or scalar at a time, for protocol
+// code that only needs part of a message. Arrays and maps are read as a
+// header followed by their elements, or by their keys and values in turn,
+// and values that are not needed can be passed over with Skip:
+//
+//	n, err := r.ReadMapHeader()
+//	for i := 0; i < n; i++ {
+//		key, err := r.ReadString()
+//		if key != "id" {
+//			err = r.Skip()
+//			continue
+//		}
+//		id, err := r.ReadInt64()
+//	}
+//
+// The lengths and payloads read are checked against the limits of the
+// DecoderOptions, apart from MaxDepth, since the Reader does not track
+// nesting. A read that finds a value of another type fails with
+// ErrTypeMismatch and leaves the value to be read again. Reads return io.EOF
+// when the input ends before a value; other errors are *DecodeError values.
+type Reader struct {
+	dec *MessagePackDecoder
+}
+
+// NewReader returns a Reader reading from r. Readers that do not implement
+// io.ByteScanner are wrapped in a bufio.Reader, so the Reader may read
+// past the last value it returns.
+func NewReader(r io.Reader) *Reader {
+	return NewReaderWithOptions(r, DecoderOptions{})
+}
+
+// NewReaderWithOptions is like NewReader but configured by opts.
+func NewReaderWithOptions(r io.Reader, opts DecoderOptions) *Reader {
+	return &Reader{dec: NewDecoderWithOptions(r, opts)}
+}
+
+// PeekType returns the type of the next value without reading it.
+func (r *Reader) PeekType() (Type, error) {
+	b, err := r.PeekFormat()
+	if err != nil {
+		return InvalidType, err
+	}
+	return TypeOf(b), nil
+}
+
+// PeekFormat returns the format byte of the next value without reading it.
+func (r *Reader) PeekFormat() (byte, error) {
+	b, _, err := r.dec.readFormat()
+	if err != nil {
+		return 0, err
+	}
+	return b, r.dec.reader.UnreadByte()
+}
+
+// read reads the next format byte and passes it to f. The format byte is
+// put back when f fails with ErrTypeMismatch.
+func (r *Reader) read(f func(b byte) error) error {
+	dec := r.dec
+
+	b, offset, err := dec.readFormat()
+	if err != nil {
+		return err
+	}
+	dec.traceFormat("read", offset, b)
+
+	dec.allocated = 0
+	if err := f(b); err != nil {
+		if err == ErrTypeMismatch {
+			dec.reader.UnreadByte()
+		}
+		return newDecodeError(err, offset, b)
+	}
+	return nil
+}
+
+// ReadArrayHeader reads the header of an array and returns its length.
+func (r *Reader) ReadArrayHeader() (length int, err error) {
+	err = r.read(func(b byte) error {
+		switch {
+		case b >= FormatFixarrayMin && b <= FormatFixarrayMax:
+			length = int(b & 0x0F)
+		case b == FormatArray16 || b == FormatArray32:
+			n, err := r.dec.readLength(16 << (b - FormatArray16))
+			if err != nil {
+				return err
+			}
+			length = int(n)
+		default:
+			return ErrTypeMismatch
+		}
+		return r.dec.checkContainer(length, 1)
+	})
+	return length, err
+}
+
+// ReadMapHeader reads the header of a map and returns its number of
+// entries.
+func (r *Reader) ReadMapHeader() (length int, err error) {
+	err = r.read(func(b byte) error {
+		switch {
+		case b >= FormatFixmapMin && b <= FormatFixmapMax:
+			length = int(b & 0x0F)
+		case b == FormatMap16 || b == FormatMap32:
+			n, err := r.dec.readLength(16 << (b - FormatMap16))
+			if err != nil {
+				return err
+			}
+			length = int(n)
+		default:
+			return ErrTypeMismatch
+		}
+		return r.dec.checkContainer(length, 2)
+	})
+	return length, err
+}
+
+// ReadString reads a str.
+func (r *Reader) ReadString() (s string, err error) {
+	err = r.read(func(b byte) error {
+		switch {
+		case b >= FormatFixstrMin && b <= FormatFixstrMax:
+			s, err = r.dec.readString(int(b & 0x1F))
+		case b >= FormatStr8 && b <= FormatStr32:
+			s, err = r.dec.readStrWithLengthInBits(8 << (b - FormatStr8))
+		default:
+			return ErrTypeMismatch
+		}
+		return err
+	})
+	return s, err
+}
+
+// ReadBytes reads a bin, or the bytes of a str.
+func (r *Reader) ReadBytes() (data []byte, err error) {
+	err = r.read(func(b byte) error {
+		switch {
+		case b >= FormatBin8 && b <= FormatBin32:
+			data, err = r.dec.readBinWithLengthInBits(8 << (b - FormatBin8))
+		case b >= FormatFixstrMin && b <= FormatFixstrMax:
+			data, err = r.dec.readBytes(int(b&0x1F), r.dec.opts.MaxStringLen, ErrMaxStringLenExceeded)
+		case b >= FormatStr8 && b <= FormatStr32:
+			var length int64
+			if length, err = r.dec.readLength(8 << (b - FormatStr8)); err == nil {
+				data, err = r.dec.readBytes(int(length), r.dec.opts.MaxStringLen, ErrMaxStringLenExceeded)
+			}
+		default:
+			return ErrTypeMismatch
+		}
+		return err
+	})
+	return data, err
+}
+
+// ReadInt64 reads an int or uint, failing with ErrValueOutOfRange for a
+// uint 64 above math.MaxInt64.
+func (r *Reader) ReadInt64() (v int64, err error) {
+	err = r.read(func(b byte) error {
+		if TypeOf(b) != IntType {
+			return ErrTypeMismatch
+		}
+		data, err := r.dec.decodeFormat(b)
+		if err != nil {
+			return err
+		}
+		v, err = toInt64(reflect.ValueOf(data))
+		return err
+	})
+	return v, err
+}
+
+// ReadUint64 reads an int or uint, failing with ErrValueOutOfRange for a
+// negative value.
+func (r *Reader) ReadUint64() (v uint64, err error) {
+	err = r.read(func(b byte) error {
+		if TypeOf(b) != IntType {
+			return ErrTypeMismatch
+		}
+		data, err := r.dec.decodeFormat(b)
+		if err != nil {
+			return err
+		}
+		v, err = toUint64(reflect.ValueOf(data))
+		return err
+	})
+	return v, err
+}
+
+// ReadFloat64 reads a float 32 or float 64.
+func (r *Reader) ReadFloat64() (v float64, err error) {
+	err = r.read(func(b byte) error {
+		switch b {
+		case FormatFloat32:
+			f, err := r.dec.readFloat32()
+			v = float64(f)
+			return err
+		case FormatFloat64:
+			v, err = r.dec.readFloat64()
+			return err
+		}
+		return ErrTypeMismatch
+	})
+	return v, err
+}
+
+// ReadBool reads true or false.
+func (r *Reader) ReadBool() (v bool, err error) {
+	err = r.read(func(b byte) error {
+		switch b {
+		case FormatFalse:
+			v = false
+		case FormatTrue:
+			v = true
+		default:
+			return ErrTypeMismatch
+		}
+		return nil
+	})
+	return v, err
+}
+
+// ReadNil reads nil.
+func (r *Reader) ReadNil() error {
+	return r.read(func(b byte) error {
+		if b != FormatNil {
+			return ErrTypeMismatch
+		}
+		return nil
+	})
+}
+
+// ReadExt reads an extension value as is, without converting registered
+// types or timestamps.
+func (r *Reader) ReadExt() (ext Ext, err error) {
+	err = r.read(func(b byte) error {
+		switch {
+		case b >= FormatFixext1 && b <= FormatFixext16:
+			ext, err = r.dec.readExt(1 << (b - FormatFixext1))
+		case b >= FormatExt8 && b <= FormatExt32:
+			ext, err = r.dec.readExtWithLengthInBits(8 << (b - FormatExt8))
+		default:
+			return ErrTypeMismatch
+		}
+		return err
+	})
+	return ext, err
+}
+
+// Skip reads past the next value, including everything inside an array or
+// map. Payloads are discarded as they are read, so nothing is allocated for
+// them.
+func (r *Reader) Skip() error {
+	return r.dec.skip()
+}
@@ -0,0 +1,177 @@
+package msgpack
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestReader(t *testing.T) {
+	// {"id": 7, "skip": [1, {"a": "b"}, 1.5], "tags": ["x"], "blob": bin, "ext": ext}
+	input := []byte{
+		0x85,
+		0xA2, 'i', 'd', 0xCD, 0x00, 0x07,
+		0xA4, 's', 'k', 'i', 'p', 0x93, 0x01, 0x81, 0xA1, 'a', 0xA1, 'b', 0xCB, 0x3F, 0xF8, 0, 0, 0, 0, 0, 0,
+		0xA4, 't', 'a', 'g', 's', 0xDC, 0x00, 0x01, 0xD9, 0x01, 'x',
+		0xA4, 'b', 'l', 'o', 'b', 0xC4, 0x02, 0x01, 0x02,
+		0xA3, 'e', 'x', 't', 0xD6, 0xFF, 0x00, 0x00, 0x00, 0x01,
+	}
+	r := NewReader(bytes.NewReader(input))
+
+	if typ, err := r.PeekType(); err != nil || typ != MapType {
+		t.Fatalf("PeekType() = %v, %v, want map", typ, err)
+	}
+	if n, err := r.ReadMapHeader(); err != nil || n != 5 {
+		t.Fatalf("ReadMapHeader() = %d, %v, want 5", n, err)
+	}
+
+	if key, err := r.ReadString(); err != nil || key != "id" {
+		t.Fatalf("ReadString() = %q, %v, want id", key, err)
+	}
+	if id, err := r.ReadInt64(); err != nil || id != 7 {
+		t.Fatalf("ReadInt64() = %d, %v, want 7", id, err)
+	}
+
+	if _, err := r.ReadString(); err != nil {
+		t.Fatalf("ReadString() error = %v", err)
+	}
+	if err := r.Skip(); err != nil {
+		t.Fatalf("Skip() error = %v", err)
+	}
+
+	if _, err := r.ReadString(); err != nil {
+		t.Fatalf("ReadString() error = %v", err)
+	}
+	if n, err := r.ReadArrayHeader(); err != nil || n != 1 {
+		t.Fatalf("ReadArrayHeader() = %d, %v, want 1", n, err)
+	}
+	if tag, err := r.ReadString(); err != nil || tag != "x" {
+		t.Fatalf("ReadString() = %q, %v, want x", tag, err)
+	}
+
+	if _, err := r.ReadString(); err != nil {
+		t.Fatalf("ReadString() error = %v", err)
+	}
+	if blob, err := r.ReadBytes(); err != nil || !bytes.Equal(blob, []byte{1, 2}) {
+		t.Fatalf("ReadBytes() = % X, %v, want 01 02", blob, err)
+	}
+
+	if _, err := r.ReadString(); err != nil {
+		t.Fatalf("ReadString() error = %v", err)
+	}
+	ext, err := r.ReadExt()
+	if err != nil || ext.Type != -1 || !bytes.Equal(ext.Data, []byte{0, 0, 0, 1}) {
+		t.Fatalf("ReadExt() = %v, %v", ext, err)
+	}
+
+	if _, err := r.PeekType(); err != io.EOF {
+		t.Errorf("PeekType() at end error = %v, want io.EOF", err)
+	}
+}
+
+func TestReaderTypeMismatch(t *testing.T) {
+	r := NewReader(bytes.NewReader([]byte{0xA1, 'a'}))
+
+	_, err := r.ReadInt64()
+	if !errors.Is(err, ErrTypeMismatch) {
+		t.Fatalf("ReadInt64() error = %v, wantErr %v", err, ErrTypeMismatch)
+	}
+	var de *DecodeError
+	if !errors.As(err, &de) || de.Format != 0xA1 {
+		t.Errorf("ReadInt64() error = %#v, want a DecodeError for 0xA1", err)
+	}
+
+	// the value is still there
+	if s, err := r.ReadString(); err != nil || s != "a" {
+		t.Errorf("ReadString() = %q, %v, want a", s, err)
+	}
+}
+
+func TestReaderInts(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []byte
+		expected int64
+		wantErr  error
+	}{
+		{name: "positive fixint", input: []byte{0x05}, expected: 5},
+		{name: "negative fixint", input: []byte{0xFF}, expected: -1},
+		{name: "uint 64", input: []byte{0xCF, 0, 0, 0, 0, 0, 0, 0x01, 0x00}, expected: 256},
+		{name: "int 16", input: []byte{0xD1, 0xFF, 0x00}, expected: -256},
+		{name: "uint 64 too large", input: []byte{0xCF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, wantErr: ErrValueOutOfRange},
+		{name: "float", input: []byte{0xCA, 0x3F, 0x80, 0x00, 0x00}, wantErr: ErrTypeMismatch},
+		{name: "truncated", input: []byte{0xCD, 0x00}, wantErr: io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewReader(bytes.NewReader(tt.input)).ReadInt64()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ReadInt64() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if v != tt.expected {
+				t.Errorf("ReadInt64() = %d, want %d", v, tt.expected)
+			}
+		})
+	}
+}
+
+func TestReaderSkip(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []byte
+		wantErr error
+	}{
+		{name: "scalar", input: []byte{0xC3}},
+		{name: "nested", input: []byte{0x92, 0x81, 0xA1, 'a', 0x91, 0xC0, 0xDE, 0x00, 0x01, 0x01, 0x02}},
+		{name: "payloads", input: []byte{0x94, 0xC5, 0x00, 0x01, 0xFF, 0xC7, 0x01, 0x05, 0xAA, 0xD4, 0x05, 0xAA, 0xD3, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{name: "truncated payload", input: []byte{0xDA, 0x00, 0x05, 'a'}, wantErr: io.ErrUnexpectedEOF},
+		{name: "truncated array", input: []byte{0x92, 0x01}, wantErr: io.ErrUnexpectedEOF},
+		{name: "never used", input: []byte{0xC1}, wantErr: ErrUnsupportedType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// a value after the skipped one must be read intact
+			input := append(append([]byte{}, tt.input...), 0x2A)
+			if tt.wantErr != nil {
+				input = tt.input
+			}
+			r := NewReader(bytes.NewReader(input))
+
+			err := r.Skip()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Skip() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if v, err := r.ReadInt64(); err != nil || v != 42 {
+				t.Errorf("ReadInt64() after Skip() = %d, %v, want 42", v, err)
+			}
+		})
+	}
+}
+
+func TestReaderLimits(t *testing.T) {
+	r := NewReaderWithOptions(bytes.NewReader([]byte{0x93, 0x01, 0x02, 0x03}), DecoderOptions{MaxContainerLen: 2})
+	if _, err := r.ReadArrayHeader(); !errors.Is(err, ErrMaxContainerLenExceeded) {
+		t.Errorf("ReadArrayHeader() error = %v, wantErr %v", err, ErrMaxContainerLenExceeded)
+	}
+}
+
+func TestTypeOf(t *testing.T) {
+	tests := []struct {
+		format   byte
+		expected Type
+	}{
+		{0x00, IntType}, {0x8F, MapType}, {0x90, ArrayType}, {0xBF, StrType}, {FormatNil, NilType},
+		{FormatNeverUsed, InvalidType}, {FormatTrue, BoolType}, {FormatBin16, BinType}, {FormatExt32, ExtType},
+		{FormatFloat32, FloatType}, {FormatUint64, IntType}, {FormatInt8, IntType}, {FormatFixext16, ExtType},
+		{FormatStr8, StrType}, {FormatArray32, ArrayType}, {FormatMap16, MapType}, {0xE0, IntType},
+	}
+	for _, tt := range tests {
+		if typ := TypeOf(tt.format); typ != tt.expected {
+			t.Errorf("TypeOf(0x%02X) = %v, want %v", tt.format, typ, tt.expected)
+		}
+	}
+}
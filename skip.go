@@ -0,0 +1,74 @@
+package msgpack
+
+import "io"
+
+// skip reads past the next value without decoding it.
+func (dec *MessagePackDecoder) skip() error {
+	for pending, first := 1, true; pending > 0; pending, first = pending-1, false {
+		b, offset, err := dec.readFormat()
+		if err != nil {
+			if err == io.EOF && !first {
+				return newDecodeError(err, offset, 0)
+			}
+			return err
+		}
+
+		values, payload, err := dec.skipFormat(b)
+		if err == nil && payload > 0 {
+			_, err = io.CopyN(io.Discard, dec.reader, payload)
+		}
+		if err != nil {
+			return newDecodeError(err, offset, b)
+		}
+		pending += values
+	}
+	return nil
+}
+
+// skipFormat reads the length of the value introduced by b, if it has one,
+// and returns how many values it contains and how many bytes follow before
+// them.
+func (dec *MessagePackDecoder) skipFormat(b byte) (values int, payload int64, err error) {
+	switch {
+	case b <= FormatPositiveFixintMax, b >= FormatNegativeFixintMin:
+		return 0, 0, nil
+	case b <= FormatFixmapMax:
+		return 2 * int(b&0x0F), 0, nil
+	case b <= FormatFixarrayMax:
+		return int(b & 0x0F), 0, nil
+	case b <= FormatFixstrMax:
+		return 0, int64(b & 0x1F), nil
+	}
+
+	switch b {
+	case FormatNil, FormatFalse, FormatTrue:
+		return 0, 0, nil
+	case FormatBin8, FormatBin16, FormatBin32:
+		payload, err = dec.readLength(8 << (b - FormatBin8))
+		return 0, payload, err
+	case FormatStr8, FormatStr16, FormatStr32:
+		payload, err = dec.readLength(8 << (b - FormatStr8))
+		return 0, payload, err
+	case FormatExt8, FormatExt16, FormatExt32:
+		// the type byte comes before the data
+		payload, err = dec.readLength(8 << (b - FormatExt8))
+		return 0, payload + 1, err
+	case FormatFixext1, FormatFixext2, FormatFixext4, FormatFixext8, FormatFixext16:
+		return 0, 1 + 1<<(b-FormatFixext1), nil
+	case FormatFloat32:
+		return 0, 4, nil
+	case FormatFloat64:
+		return 0, 8, nil
+	case FormatUint8, FormatUint16, FormatUint32, FormatUint64:
+		return 0, 1 << (b - FormatUint8), nil
+	case FormatInt8, FormatInt16, FormatInt32, FormatInt64:
+		return 0, 1 << (b - FormatInt8), nil
+	case FormatArray16, FormatArray32:
+		n, err := dec.readLength(16 << (b - FormatArray16))
+		return int(n), 0, err
+	case FormatMap16, FormatMap32:
+		n, err := dec.readLength(16 << (b - FormatMap16))
+		return 2 * int(n), 0, err
+	}
+	return 0, 0, ErrUnsupportedType
+}
@@ -0,0 +1,70 @@
+package msgpack
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// timestampExtType is the extension type the MessagePack spec reserves for
+// timestamps.
+const timestampExtType int8 = -1
+
+// encodeTimestamp writes t in the smallest timestamp layout that holds it:
+//   - timestamp 32: seconds in [0, 2^32) without nanoseconds
+//   - timestamp 64: seconds in [0, 2^34) with nanoseconds
+//   - timestamp 96: any other instant
+func encodeTimestamp(buf writer, t time.Time) error {
+	secs := t.Unix()
+	nsecs := int64(t.Nanosecond())
+
+	var data []byte
+	switch {
+	case secs>>34 == 0 && nsecs == 0 && secs <= 0xFFFFFFFF:
+		data = binary.BigEndian.AppendUint32(nil, uint32(secs))
+
+	case secs>>34 == 0:
+		data = binary.BigEndian.AppendUint64(nil, uint64(nsecs)<<34|uint64(secs))
+
+	default:
+		data = binary.BigEndian.AppendUint32(make([]byte, 0, 12), uint32(nsecs))
+		data = binary.BigEndian.AppendUint64(data, uint64(secs))
+	}
+
+	if err := encodeExt(buf, timestampExtType, data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// decodeTimestamp parses the payload of a timestamp extension. The result is
+// in UTC.
+func decodeTimestamp(data []byte) (time.Time, error) {
+	var secs, nsecs int64
+
+	switch len(data) {
+	// timestamp 32
+	case 4:
+		secs = int64(binary.BigEndian.Uint32(data))
+
+	// timestamp 64
+	case 8:
+		v := binary.BigEndian.Uint64(data)
+		nsecs = int64(v >> 34)
+		secs = int64(v & 0x3FFFFFFFF)
+
+	// timestamp 96
+	case 12:
+		nsecs = int64(binary.BigEndian.Uint32(data))
+		secs = int64(binary.BigEndian.Uint64(data[4:]))
+
+	default:
+		return time.Time{}, ErrTimestampInvalid
+	}
+
+	if nsecs > 999999999 {
+		return time.Time{}, ErrTimestampInvalid
+	}
+
+	return time.Unix(secs, nsecs).UTC(), nil
+}
@@ -0,0 +1,99 @@
+package msgpack
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTimestampRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  time.Time
+		prefix []byte
+		size   int
+	}{
+		{name: "timestamp 32, epoch", value: time.Unix(0, 0), prefix: []byte{0xD6, 0xFF}, size: 6},
+		{name: "timestamp 32, max", value: time.Unix(0xFFFFFFFF, 0), prefix: []byte{0xD6, 0xFF}, size: 6},
+		{name: "timestamp 64, nanoseconds", value: time.Unix(1700000000, 123456789), prefix: []byte{0xD7, 0xFF}, size: 10},
+		{name: "timestamp 64, seconds over 32 bits", value: time.Unix(0x100000000, 0), prefix: []byte{0xD7, 0xFF}, size: 10},
+		{name: "timestamp 64, max", value: time.Unix(0x3FFFFFFFF, 999999999), prefix: []byte{0xD7, 0xFF}, size: 10},
+		{name: "timestamp 96, seconds over 34 bits", value: time.Unix(0x400000000, 0), prefix: []byte{0xC7, 0x0C, 0xFF}, size: 15},
+		{name: "timestamp 96, pre-1970", value: time.Date(1969, 7, 20, 20, 17, 40, 5, time.UTC), prefix: []byte{0xC7, 0x0C, 0xFF}, size: 15},
+		{name: "timestamp 96, year 1", value: time.Date(1, 1, 1, 0, 0, 0, 1, time.UTC), prefix: []byte{0xC7, 0x0C, 0xFF}, size: 15},
+		{name: "timestamp 96, far future", value: time.Date(9999, 12, 31, 23, 59, 59, 999999999, time.UTC), prefix: []byte{0xC7, 0x0C, 0xFF}, size: 15},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := Marshal(tt.value)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			if !bytes.HasPrefix(encoded, tt.prefix) || len(encoded) != tt.size {
+				t.Errorf("Marshal() = % X, want prefix % X and size %v", encoded, tt.prefix, tt.size)
+			}
+
+			result, err := NewMessagePackDecoder(encoded).Decode()
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			decoded, ok := result.(time.Time)
+			if !ok || !decoded.Equal(tt.value) {
+				t.Errorf("Decode() = %v, want %v", result, tt.value)
+			}
+		})
+	}
+}
+
+func TestTimestampLayouts(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []byte
+		expected time.Time
+	}{
+		{name: "timestamp 32", input: []byte{0xD6, 0xFF, 0x00, 0x00, 0x00, 0x01}, expected: time.Unix(1, 0)},
+		{name: "timestamp 64", input: []byte{0xD7, 0xFF, 0x00, 0x00, 0x00, 0x04, 0x00, 0x00, 0x00, 0x02}, expected: time.Unix(2, 1)},
+		{name: "timestamp 96", input: []byte{0xC7, 0x0C, 0xFF, 0x00, 0x00, 0x00, 0x03, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, expected: time.Unix(-1, 3)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var decoded time.Time
+			if err := Unmarshal(tt.input, &decoded); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !decoded.Equal(tt.expected) {
+				t.Errorf("Unmarshal() = %v, want %v", decoded, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTimestampInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+	}{
+		{name: "wrong size", input: []byte{0xD5, 0xFF, 0x00, 0x00}},
+		{name: "nanoseconds out of range", input: []byte{0xC7, 0x0C, 0xFF, 0x3B, 0x9A, 0xCA, 0x00, 0, 0, 0, 0, 0, 0, 0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewMessagePackDecoder(tt.input).Decode(); !errors.Is(err, ErrTimestampInvalid) {
+				t.Errorf("Decode() error = %v, wantErr %v", err, ErrTimestampInvalid)
+			}
+		})
+	}
+}
+
+func TestTimestampEncode(t *testing.T) {
+	var buf bytes.Buffer
+	if err := encode(&buf, map[string]interface{}{"at": time.Unix(1, 0)}); err != nil {
+		t.Fatalf("encode() error = %v", err)
+	}
+
+	expected := []byte{0x81, 0xA2, 'a', 't', 0xD6, 0xFF, 0x00, 0x00, 0x00, 0x01}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("encode() = % X, want % X", buf.Bytes(), expected)
+	}
+}
@@ -0,0 +1,108 @@
+package msgpack
+
+// Token is a value returned by MessagePackDecoder.Token: ArrayStart,
+// ArrayEnd, MapStart or MapEnd, or a scalar as Decode returns it.
+type Token interface{}
+
+// ArrayStart opens an array of Len elements.
+type ArrayStart struct {
+	Len int
+}
+
+// ArrayEnd closes the array opened by the matching ArrayStart.
+type ArrayEnd struct{}
+
+// MapStart opens a map of Len entries. Its keys and values follow in turn.
+type MapStart struct {
+	Len int
+}
+
+// MapEnd closes the map opened by the matching MapStart.
+type MapEnd struct{}
+
+// tokenFrame is an array or map opened by Token.
+type tokenFrame struct {
+	isMap     bool
+	remaining int // elements, or keys and values, not read yet
+}
+
+// Token returns the next token of the input, so a large array or map can be
+// read one element at a time instead of being built in memory as a whole.
+// Arrays and maps are returned as ArrayStart or MapStart, their elements,
+// and ArrayEnd or MapEnd; every other value is returned as Decode returns
+// it. Decode may be called in place of Token to read the next element, key
+// or value as a whole:
+//
+//	tok, err := dec.Token() // ArrayStart{Len: n}
+//	for dec.More() {
+//		record, err := dec.Decode()
+//	}
+//	tok, err = dec.Token() // ArrayEnd{}
+//
+// Token returns io.EOF when the input ends cleanly between top-level
+// values; every other error is a *DecodeError. The limits of the
+// DecoderOptions apply to each array and map opened, and MaxAlloc to each
+// token or value decoded on its own.
+func (dec *MessagePackDecoder) Token() (Token, error) {
+	if n := len(dec.tokens); n > 0 {
+		top := dec.tokens[n-1]
+		if top.remaining == 0 {
+			dec.tokens = dec.tokens[:n-1]
+			dec.leaveContainer()
+			if top.isMap {
+				return MapEnd{}, nil
+			}
+			return ArrayEnd{}, nil
+		}
+		dec.tokens[n-1].remaining--
+	}
+
+	b, offset, err := dec.readFormat()
+	if err != nil {
+		return nil, err
+	}
+	dec.traceFormat("token", offset, b)
+
+	length, isMap, isContainer, err := dec.readContainerHeader(b)
+	if err != nil {
+		return nil, newDecodeError(err, offset, b)
+	}
+	if isContainer {
+		slots := 1
+		if isMap {
+			slots = 2
+		}
+		if err := dec.checkContainer(length, slots); err != nil {
+			return nil, newDecodeError(err, offset, b)
+		}
+		dec.depth++
+		dec.tokens = append(dec.tokens, tokenFrame{isMap: isMap, remaining: length * slots})
+
+		if isMap {
+			return MapStart{Len: length}, nil
+		}
+		return ArrayStart{Len: length}, nil
+	}
+
+	dec.allocated = 0
+	v, err := dec.decodeFormat(b)
+	if err != nil {
+		return nil, newDecodeError(err, offset, b)
+	}
+	return v, nil
+}
+
+// More reports whether the array or map opened last by Token has another
+// element, key or value, or at the top level whether the input holds
+// another value.
+func (dec *MessagePackDecoder) More() bool {
+	if n := len(dec.tokens); n > 0 {
+		return dec.tokens[n-1].remaining > 0
+	}
+
+	if _, err := dec.reader.ReadByte(); err != nil {
+		return false
+	}
+	dec.reader.UnreadByte()
+	return true
+}
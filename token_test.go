@@ -0,0 +1,119 @@
+package msgpack
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestDecoderToken(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []byte
+		expected []Token
+	}{
+		{name: "scalar", input: []byte{0xA1, 'a'}, expected: []Token{"a"}},
+		{name: "empty array", input: []byte{0x90}, expected: []Token{ArrayStart{Len: 0}, ArrayEnd{}}},
+		{
+			name:     "nested",
+			input:    []byte{0x92, 0x81, 0xA1, 'a', 0xC3, 0xDC, 0x00, 0x01, 0xC0},
+			expected: []Token{ArrayStart{Len: 2}, MapStart{Len: 1}, "a", true, MapEnd{}, ArrayStart{Len: 1}, nil, ArrayEnd{}, ArrayEnd{}},
+		},
+		{name: "consecutive values", input: []byte{0x01, 0x90}, expected: []Token{uint8(1), ArrayStart{Len: 0}, ArrayEnd{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec := NewMessagePackDecoder(tt.input)
+
+			var tokens []Token
+			for {
+				tok, err := dec.Token()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Token() error = %v", err)
+				}
+				tokens = append(tokens, tok)
+			}
+			if !reflect.DeepEqual(tokens, tt.expected) {
+				t.Errorf("Token() = %#v, want %#v", tokens, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDecoderTokenDecode(t *testing.T) {
+	// [{"id": 1}, {"id": 2}] followed by 3
+	input := []byte{0x92, 0x81, 0xA2, 'i', 'd', 0x01, 0x81, 0xA2, 'i', 'd', 0x02, 0x03}
+	dec := NewMessagePackDecoder(input)
+
+	if tok, err := dec.Token(); err != nil || tok != (ArrayStart{Len: 2}) {
+		t.Fatalf("Token() = %v, %v, want ArrayStart{2}", tok, err)
+	}
+
+	var records []interface{}
+	for dec.More() {
+		record, err := dec.Decode()
+		if err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		records = append(records, record)
+	}
+	expected := []interface{}{map[string]interface{}{"id": uint8(1)}, map[string]interface{}{"id": uint8(2)}}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("Decode() = %v, want %v", records, expected)
+	}
+
+	if _, err := dec.Decode(); !errors.Is(err, ErrEndOfContainer) {
+		t.Errorf("Decode() at the end error = %v, wantErr %v", err, ErrEndOfContainer)
+	}
+	if tok, err := dec.Token(); err != nil || tok != (ArrayEnd{}) {
+		t.Fatalf("Token() = %v, %v, want ArrayEnd", tok, err)
+	}
+
+	if !dec.More() {
+		t.Fatal("More() = false before the last value")
+	}
+	if v, err := dec.Decode(); err != nil || v != uint8(3) {
+		t.Errorf("Decode() = %v, %v, want 3", v, err)
+	}
+	if dec.More() {
+		t.Error("More() = true at the end of the input")
+	}
+}
+
+func TestDecoderTokenErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []byte
+		opts    DecoderOptions
+		wantErr error
+	}{
+		{name: "truncated array", input: []byte{0x92, 0x01}, wantErr: io.ErrUnexpectedEOF},
+		{name: "truncated header", input: []byte{0xDC, 0x00}, wantErr: io.ErrUnexpectedEOF},
+		{name: "never used", input: []byte{0x91, 0xC1}, wantErr: ErrUnsupportedType},
+		{name: "max depth", input: []byte{0x91, 0x91, 0x90}, opts: DecoderOptions{MaxDepth: 2}, wantErr: ErrMaxDepthExceeded},
+		{name: "max container len", input: []byte{0x92, 0x01, 0x02}, opts: DecoderOptions{MaxContainerLen: 1}, wantErr: ErrMaxContainerLenExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// a stream, so lengths are not checked against the remaining input
+			dec := NewDecoderWithOptions(struct{ io.Reader }{bytes.NewReader(tt.input)}, tt.opts)
+
+			var err error
+			for err == nil {
+				_, err = dec.Token()
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Token() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var de *DecodeError
+			if !errors.As(err, &de) {
+				t.Errorf("Token() error = %#v, want a *DecodeError", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,755 @@
+package msgpack
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math"
+	"reflect"
+)
+
+// TranscodeJSON converts the JSON document read from src to MessagePack
+// written to dst with the zero Options.
+func TranscodeJSON(dst io.Writer, src io.Reader) error {
+	return Options{}.TranscodeJSON(dst, src)
+}
+
+// TranscodeJSON is like JSONToMessagePack but converts the document token by
+// token, without holding it in memory, and keeps object keys in the order
+// they appear. Encoder.Canonical therefore applies to numbers only.
+//
+// MessagePack writes the length of an array or map before its elements.
+// When src is an io.ReadSeeker the lengths are counted in a first pass over
+// the input, which is then read again from where it started. Memory then
+// grows by one int per array and object in the document, but not with the
+// size of its strings, numbers or keys. Nothing is written if the first
+// pass finds the input invalid.
+//
+// Other readers, such as pipes and sockets, are converted in a single pass
+// that holds back the output from the outermost array or object on until
+// it is closed. Memory is O(document) for them: bounded memory is not
+// available when src cannot seek, so large documents should be passed as a
+// file. Typed JSON, read when o.TypedJSON is set, is always converted this
+// way.
+func (o Options) TranscodeJSON(dst io.Writer, src io.Reader) error {
+	if o.TypedJSON {
+		w := bufio.NewWriter(dst)
+		if err := o.readTypedJSON(w, src); err != nil {
+			return err
+		}
+		return w.Flush()
+	}
+
+	var counts []int
+	if seeker, ok := src.(io.ReadSeeker); ok {
+		if start, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			if counts, err = countJSON(src); err != nil {
+				return err
+			}
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return err
+			}
+		}
+	}
+
+	w := bufio.NewWriter(dst)
+	t := &jsonTranscoder{
+		es:     o.newBridgeEncodeState(w),
+		opts:   o,
+		counts: counts,
+	}
+
+	dec := json.NewDecoder(src)
+	dec.UseNumber()
+	if err := t.run(dec); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// jsonTranscoder carries the state of one TranscodeJSON call.
+type jsonTranscoder struct {
+	es   *encodeState
+	opts Options
+
+	// counts holds the lengths of the arrays and objects in the order they
+	// open, or nil when the output is held back until they close.
+	counts []int
+	held   heldOutput
+
+	frames []jsonFrame
+	path   []pathStep // path[i] is the current step within frames[i]
+}
+
+// jsonFrame is an open array or object.
+type jsonFrame struct {
+	object    bool
+	expectKey bool // the next token of an object is a key
+
+	// set when the output is held back: the elements so far, and the
+	// header the container got from heldOutput.open
+	count  int
+	header int
+}
+
+// heldOutput holds back MessagePack output whose array and map lengths are
+// not known yet. Everything from the outermost open container on goes into
+// one buffer, and the headers are inserted as the outermost container
+// closes, so each byte is copied once however deeply the containers nest.
+type heldOutput struct {
+	buf     bytes.Buffer
+	out     writer // where buf goes once the outermost container closes
+	depth   int    // containers open
+	headers []heldHeader
+}
+
+// heldHeader is the header of a held back array or map, to be written at
+// pos in the held output.
+type heldHeader struct {
+	pos    int
+	object bool
+	format byte // zero for the smallest format that fits count
+	count  int
+}
+
+// open starts an array or map whose elements are written to h.writer, in
+// format or in the smallest format when that is zero. w is where the output
+// goes if this is the outermost container. It returns the header to pass to
+// close.
+func (h *heldOutput) open(w writer, object bool, format byte) int {
+	if h.depth == 0 {
+		h.out = w
+	}
+	h.depth++
+	h.headers = append(h.headers, heldHeader{pos: h.buf.Len(), object: object, format: format})
+	return len(h.headers) - 1
+}
+
+// writer returns the writer of the elements of the open containers.
+func (h *heldOutput) writer() writer {
+	return &h.buf
+}
+
+// close ends the container of header with count elements, writing out
+// everything held back once it is the outermost.
+func (h *heldOutput) close(header, count int) error {
+	h.headers[header].count = count
+	h.depth--
+	if h.depth > 0 {
+		return nil
+	}
+
+	data := h.buf.Bytes()
+	prev := 0
+	for _, hdr := range h.headers {
+		if _, err := h.out.Write(data[prev:hdr.pos]); err != nil {
+			return err
+		}
+		prev = hdr.pos
+
+		var err error
+		switch {
+		case hdr.format != 0:
+			err = writeHeader(h.out, hdr.format, hdr.count)
+		case hdr.object:
+			err = encodeMapHeader(h.out, hdr.count)
+		default:
+			err = encodeArrayHeader(h.out, hdr.count)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := h.out.Write(data[prev:]); err != nil {
+		return err
+	}
+
+	// drop the buffer rather than keep its capacity for the next document
+	*h = heldOutput{}
+	return nil
+}
+
+// run transcodes one JSON value and checks that nothing follows it.
+func (t *jsonTranscoder) run(dec *json.Decoder) error {
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := t.token(tok); err != nil {
+			return err
+		}
+		if len(t.frames) == 0 {
+			break
+		}
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		if err == nil {
+			return ErrTrailingData
+		}
+		return err
+	}
+	return nil
+}
+
+func (t *jsonTranscoder) token(tok json.Token) error {
+	if delim, ok := tok.(json.Delim); ok && (delim == '}' || delim == ']') {
+		return t.close()
+	}
+
+	if n := len(t.frames); n > 0 {
+		frame := &t.frames[n-1]
+		if frame.expectKey {
+			frame.expectKey = false
+			frame.count++
+			t.path[n-1] = pathStep{key: tok.(string)}
+			return encodeString(t.es.buf, tok.(string))
+		}
+		if frame.object {
+			frame.expectKey = true
+		} else {
+			frame.count++
+		}
+	}
+
+	return t.value(tok)
+}
+
+// value writes a scalar, or the header of an array or object, applying the
+// mapping rules and the binary keyword like JSONToMessagePack.
+func (t *jsonTranscoder) value(tok json.Token) error {
+	if t.opts.Mapping != nil {
+		if c := t.opts.Mapping.match(t.path); c != nil {
+			// arrays and objects fail the conversion like any value of the
+			// wrong type
+			converted, err := c.toMessagePack(tok)
+			if err != nil {
+				return err
+			}
+			return t.es.encode(converted)
+		}
+	}
+
+	if n := len(t.frames); n > 0 && t.frames[n-1].object && t.es.binaryKeyword != "" && t.path[n-1].key == t.es.binaryKeyword {
+		return encodeBinary(t.es.buf, tok)
+	}
+
+	if delim, ok := tok.(json.Delim); ok {
+		return t.open(delim == '{')
+	}
+	return t.es.encode(tok)
+}
+
+func (t *jsonTranscoder) open(object bool) error {
+	frame := jsonFrame{object: object, expectKey: object}
+
+	if t.counts != nil {
+		length := t.counts[0]
+		t.counts = t.counts[1:]
+		if object {
+			if err := encodeMapHeader(t.es.buf, length); err != nil {
+				return err
+			}
+		} else if err := encodeArrayHeader(t.es.buf, length); err != nil {
+			return err
+		}
+	} else {
+		frame.header = t.held.open(t.es.buf, object, 0)
+		t.es.buf = t.held.writer()
+	}
+
+	t.frames = append(t.frames, frame)
+	t.path = append(t.path, pathStep{elem: !object})
+	return nil
+}
+
+func (t *jsonTranscoder) close() error {
+	frame := t.frames[len(t.frames)-1]
+	t.frames = t.frames[:len(t.frames)-1]
+	t.path = t.path[:len(t.path)-1]
+
+	if t.counts != nil {
+		return nil
+	}
+
+	out := t.held.out
+	if err := t.held.close(frame.header, frame.count); err != nil {
+		return err
+	}
+	if len(t.frames) == 0 {
+		t.es.buf = out
+	}
+	return nil
+}
+
+// countJSON reads one JSON value and returns the lengths of its arrays and
+// objects in the order they open.
+func countJSON(r io.Reader) ([]int, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	var counts []int
+	var open []int // indexes into counts of the open containers
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		delim, _ := tok.(json.Delim)
+		switch delim {
+		case '}', ']':
+			if delim == '}' {
+				// keys and values were counted alike
+				counts[open[len(open)-1]] /= 2
+			}
+			open = open[:len(open)-1]
+
+		default:
+			if len(open) > 0 {
+				counts[open[len(open)-1]]++
+			}
+			if delim != 0 {
+				open = append(open, len(counts))
+				counts = append(counts, 0)
+			}
+		}
+
+		if len(open) == 0 {
+			break
+		}
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		if err == nil {
+			return nil, ErrTrailingData
+		}
+		return nil, err
+	}
+	return counts, nil
+}
+
+// JSONOptions configures how TranscodeToJSON writes JSON. The zero value
+// writes compact JSON like MessagePackToJSON.
+type JSONOptions struct {
+	// Indent, when set, puts each array element and object member on a
+	// line of its own, indented by Indent once per level.
+	Indent string
+
+	// DisableHTMLEscape writes <, > and & in strings as they are rather
+	// than as \u003c, \u003e and \u0026.
+	DisableHTMLEscape bool
+
+	// Bin selects how bin values are written.
+	Bin BinFormat
+
+	// NonFinite selects how NaN and infinite floats are written.
+	NonFinite NonFiniteFormat
+
+	// NonStringKeys selects how map keys other than strings are written.
+	NonStringKeys KeyFormat
+}
+
+// BinFormat is how TranscodeToJSON writes bin values.
+type BinFormat int
+
+const (
+	// BinBase64 writes a base64 string, as encoding/json does.
+	BinBase64 BinFormat = iota
+
+	// BinHex writes a hex string.
+	BinHex
+
+	// BinWrapped writes an object holding the base64 string under
+	// Options.BinaryKeyword. Without a keyword it is the same as BinBase64.
+	BinWrapped
+)
+
+// NonFiniteFormat is how TranscodeToJSON writes NaN and infinite floats,
+// which JSON has no numbers for.
+type NonFiniteFormat int
+
+const (
+	// NonFiniteError fails with ErrFloatNotFinite.
+	NonFiniteError NonFiniteFormat = iota
+
+	// NonFiniteNull writes null.
+	NonFiniteNull
+
+	// NonFiniteString writes the strings "NaN", "Infinity" and "-Infinity".
+	NonFiniteString
+)
+
+// KeyFormat is how TranscodeToJSON writes map keys that are not strings.
+type KeyFormat int
+
+const (
+	// KeyError writes integer keys as their decimal string, as
+	// MessagePackToJSON and encoding/json do, and fails with
+	// ErrUnsupportedType for any other key.
+	KeyError KeyFormat = iota
+
+	// KeyString writes the JSON text of the key as a string, so 1 becomes
+	// "1" and true becomes "true".
+	KeyString
+)
+
+// TranscodeToJSON converts the MessagePack value read from src to JSON
+// written to dst, formatted by opts.
+func TranscodeToJSON(dst io.Writer, src io.Reader, opts JSONOptions) error {
+	return Options{JSON: opts}.TranscodeToJSON(dst, src)
+}
+
+// TranscodeToJSON is like MessagePackToJSON but writes the JSON to dst as
+// the value is parsed, without holding it in memory, formatted by o.JSON.
+// Only the string keys of the open maps are kept, to fail with
+// ErrMapKeyCollision on a str and a bin key with the same bytes as Decode
+// does.
+// Map entries keep the order they have on the wire, and MaxAlloc in
+// o.Decoder bounds each payload rather than the whole value. Data after the
+// value fails with ErrTrailingData.
+//
+// Errors are *DecodeError values. Output written before an error is not
+// taken back, so dst may hold part of a document.
+func (o Options) TranscodeToJSON(dst io.Writer, src io.Reader) error {
+	w := bufio.NewWriter(dst)
+	t := &msgpackTranscoder{
+		dec:     NewDecoderWithOptions(src, o.Decoder),
+		w:       w,
+		opts:    o,
+		mapping: o.Mapping,
+	}
+	if o.TypedJSON {
+		t.mapping = nil
+	}
+	t.enc = json.NewEncoder(&t.scratch)
+	t.enc.SetEscapeHTML(!o.JSON.DisableHTMLEscape)
+
+	if err := t.value(); err != nil {
+		t.dec.traceError("transcode failed", err)
+		return err
+	}
+
+	if b, offset, err := t.dec.readFormat(); err != io.EOF {
+		if err == nil {
+			err = &DecodeError{Offset: offset, Format: b, Err: ErrTrailingData}
+		}
+		return err
+	}
+
+	// the bufio.Writer keeps the first write error and returns it here
+	return w.Flush()
+}
+
+// msgpackTranscoder carries the state of one TranscodeToJSON call.
+type msgpackTranscoder struct {
+	dec  *MessagePackDecoder
+	w    writer
+	opts Options
+
+	// mapping is o.Mapping, or nil under a value a rule matched
+	mapping *Mapping
+	path    []pathStep
+
+	// scalars are formatted by enc into scratch
+	enc     *json.Encoder
+	scratch bytes.Buffer
+	indents string
+}
+
+// value transcodes the next value.
+func (t *msgpackTranscoder) value() (err error) {
+	dec := t.dec
+
+	b, offset, err := dec.readFormat()
+	if err != nil {
+		return newDecodeError(err, offset, b)
+	}
+	dec.traceFormat("transcode", offset, b)
+
+	defer func() {
+		if err != nil {
+			err = newDecodeError(err, offset, b)
+		}
+	}()
+
+	if t.opts.TypedJSON {
+		return t.typedValue(b)
+	}
+
+	var c *conversion
+	if t.mapping != nil {
+		c = t.mapping.match(t.path)
+	}
+
+	length, isMap, isContainer, err := t.dec.readContainerHeader(b)
+	if err != nil {
+		return err
+	}
+	if isContainer {
+		if c != nil {
+			// as in the tree walk, nothing under a matched value is converted
+			defer func(m *Mapping) { t.mapping = m }(t.mapping)
+			t.mapping = nil
+		}
+		if isMap {
+			return t.object(length)
+		}
+		return t.array(length)
+	}
+
+	// payloads are written out as soon as they are read, so the allocation
+	// budget applies to each one on its own
+	dec.allocated = 0
+
+	v, err := dec.decodeFormat(b)
+	if err != nil {
+		return err
+	}
+	if c != nil {
+		if v, err = c.toJSON(v); err != nil {
+			return err
+		}
+	}
+	return t.scalar(v)
+}
+
+func (t *msgpackTranscoder) array(length int) error {
+	if err := t.dec.checkContainer(length, 1); err != nil {
+		return err
+	}
+	t.dec.depth++
+	defer t.dec.leaveContainer()
+
+	t.path = append(t.path, pathStep{elem: true})
+	defer func() { t.path = t.path[:len(t.path)-1] }()
+
+	t.w.WriteByte('[')
+	for i := 0; i < length; i++ {
+		if i > 0 {
+			t.w.WriteByte(',')
+		}
+		t.newline(t.dec.depth)
+		if err := t.value(); err != nil {
+			return withIndex(err, i)
+		}
+	}
+	if length > 0 {
+		t.newline(t.dec.depth - 1)
+	}
+	return t.w.WriteByte(']')
+}
+
+func (t *msgpackTranscoder) object(length int) error {
+	if err := t.dec.checkContainer(length, 2); err != nil {
+		return err
+	}
+	t.dec.depth++
+	defer t.dec.leaveContainer()
+
+	t.path = append(t.path, pathStep{})
+	defer func() { t.path = t.path[:len(t.path)-1] }()
+
+	// the str and bin keys so far, true for those from a bin, to catch a
+	// str and a bin key with the same bytes as readMap does
+	var keys map[string]bool
+
+	t.w.WriteByte('{')
+	for i := 0; i < length; i++ {
+		if i > 0 {
+			t.w.WriteByte(',')
+		}
+		t.newline(t.dec.depth)
+
+		key, err := t.key(&keys)
+		if err != nil {
+			return err
+		}
+
+		if err := t.value(); err != nil {
+			return withKey(err, key)
+		}
+	}
+	if length > 0 {
+		t.newline(t.dec.depth - 1)
+	}
+	return t.w.WriteByte('}')
+}
+
+// key writes the next map key and its separator, and returns the key. Str
+// and bin keys are recorded in keys, failing with ErrMapKeyCollision when
+// the same bytes turn up as both.
+func (t *msgpackTranscoder) key(keys *map[string]bool) (interface{}, error) {
+	if t.opts.TypedJSON {
+		key, err := t.typedKey()
+		if err != nil {
+			return nil, err
+		}
+		return key, t.writeKey(key)
+	}
+
+	t.dec.allocated = 0
+
+	key, err := t.dec.decode()
+	if err != nil {
+		return nil, err
+	}
+
+	_, fromBin := key.([]byte)
+	key, err = mapKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	keyStr, ok := key.(string)
+	if ok {
+		if fromBinBefore, seen := (*keys)[keyStr]; seen && fromBinBefore != fromBin {
+			return nil, ErrMapKeyCollision
+		}
+		if *keys == nil {
+			*keys = map[string]bool{}
+		}
+		(*keys)[keyStr] = fromBin
+	} else {
+		if t.opts.JSON.NonStringKeys != KeyString && !isIntegerKey(key) {
+			return nil, ErrUnsupportedType
+		}
+		text, err := t.format(key)
+		if err != nil {
+			return nil, err
+		}
+		keyStr = string(text)
+	}
+	return key, t.writeKey(keyStr)
+}
+
+// isIntegerKey reports whether key is an int or uint, which JSON can hold
+// as a decimal string.
+func isIntegerKey(key interface{}) bool {
+	switch reflect.ValueOf(key).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// writeKey writes key and its separator and makes it the last step of the
+// path.
+func (t *msgpackTranscoder) writeKey(key string) error {
+	t.path[len(t.path)-1] = pathStep{key: key}
+
+	if err := t.write(key); err != nil {
+		return err
+	}
+	t.w.WriteByte(':')
+	if t.opts.JSON.Indent != "" {
+		t.w.WriteByte(' ')
+	}
+	return nil
+}
+
+func (t *msgpackTranscoder) scalar(v interface{}) error {
+	switch v := v.(type) {
+	case float32:
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return t.nonFinite(float64(v))
+		}
+
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return t.nonFinite(v)
+		}
+
+	case []byte:
+		switch {
+		case t.opts.JSON.Bin == BinHex:
+			return t.write(hex.EncodeToString(v))
+
+		case t.opts.JSON.Bin == BinWrapped && t.opts.BinaryKeyword != "":
+			t.w.WriteByte('{')
+			t.newline(t.dec.depth + 1)
+			if err := t.write(t.opts.BinaryKeyword); err != nil {
+				return err
+			}
+			t.w.WriteByte(':')
+			if t.opts.JSON.Indent != "" {
+				t.w.WriteByte(' ')
+			}
+			if err := t.write(v); err != nil {
+				return err
+			}
+			t.newline(t.dec.depth)
+			return t.w.WriteByte('}')
+		}
+	}
+
+	return t.write(v)
+}
+
+func (t *msgpackTranscoder) nonFinite(f float64) error {
+	switch t.opts.JSON.NonFinite {
+	case NonFiniteNull:
+		_, err := t.w.WriteString("null")
+		return err
+
+	case NonFiniteString:
+		switch {
+		case math.IsInf(f, 1):
+			return t.write("Infinity")
+		case math.IsInf(f, -1):
+			return t.write("-Infinity")
+		}
+		return t.write("NaN")
+	}
+
+	return ErrFloatNotFinite
+}
+
+// write writes the JSON encoding of v.
+func (t *msgpackTranscoder) write(v interface{}) error {
+	text, err := t.format(v)
+	if err != nil {
+		return err
+	}
+	_, err = t.w.Write(text)
+	return err
+}
+
+// format returns the JSON encoding of v, indented to the current depth. The
+// result is only valid until the next call.
+func (t *msgpackTranscoder) format(v interface{}) ([]byte, error) {
+	t.scratch.Reset()
+	t.enc.SetIndent(t.indentation(t.dec.depth), t.opts.JSON.Indent)
+	if err := t.enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(t.scratch.Bytes(), []byte{'\n'}), nil
+}
+
+// newline starts a line indented depth times, if indenting at all.
+func (t *msgpackTranscoder) newline(depth int) {
+	if t.opts.JSON.Indent == "" {
+		return
+	}
+	t.w.WriteByte('\n')
+	t.w.WriteString(t.indentation(depth))
+}
+
+func (t *msgpackTranscoder) indentation(depth int) string {
+	n := depth * len(t.opts.JSON.Indent)
+	for len(t.indents) < n {
+		t.indents += t.opts.JSON.Indent
+	}
+	return t.indents[:n]
+}
@@ -0,0 +1,231 @@
+package msgpack
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestTranscodeJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []byte
+		wantErr  error
+	}{
+		{name: "keys keep their order", input: `{"b": 1, "a": 2}`, expected: []byte{0x82, 0xA1, 'b', 0x01, 0xA1, 'a', 0x02}},
+		{name: "nested", input: `[{"a": [true, null]}, [], {}]`, expected: []byte{0x93, 0x81, 0xA1, 'a', 0x92, 0xC3, 0xC0, 0x90, 0x80}},
+		{name: "nested first", input: `[[[1], {}], 2]`, expected: []byte{0x92, 0x92, 0x91, 0x01, 0x80, 0x02}},
+		{name: "array 16 inside", input: `[[0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0], {"a": 1}]`, expected: append(append([]byte{0x92, 0xDC, 0x00, 0x10}, make([]byte, 16)...), 0x81, 0xA1, 'a', 0x01)},
+		{name: "scalar", input: ` "x" `, expected: []byte{0xA1, 'x'}},
+		{name: "numbers", input: `[-1, 1.5]`, expected: []byte{0x92, 0xFF, 0xCA, 0x3F, 0xC0, 0x00, 0x00}},
+		{name: "empty", input: ``, wantErr: io.ErrUnexpectedEOF},
+		{name: "truncated", input: `{"a": [1`, wantErr: io.ErrUnexpectedEOF},
+		{name: "trailing value", input: `{} 1`, wantErr: ErrTrailingData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			readers := map[string]io.Reader{
+				"seeker": strings.NewReader(tt.input),
+				"stream": struct{ io.Reader }{strings.NewReader(tt.input)},
+			}
+			for kind, src := range readers {
+				var buf bytes.Buffer
+				err := TranscodeJSON(&buf, src)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("%s: TranscodeJSON() error = %v, wantErr %v", kind, err, tt.wantErr)
+				}
+				if tt.wantErr == nil && !bytes.Equal(buf.Bytes(), tt.expected) {
+					t.Errorf("%s: TranscodeJSON() = % X, want % X", kind, buf.Bytes(), tt.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestTranscodeJSONSyntaxError(t *testing.T) {
+	var buf bytes.Buffer
+	if err := TranscodeJSON(&buf, strings.NewReader(`[1, 2}`)); err == nil {
+		t.Fatal("TranscodeJSON() error = nil, want a syntax error")
+	}
+	// the counting pass finds the error before anything is written
+	if buf.Len() != 0 {
+		t.Errorf("TranscodeJSON() wrote % X", buf.Bytes())
+	}
+}
+
+func TestTranscodeJSONMatchesJSONToMessagePack(t *testing.T) {
+	input := `{"a":[1,-2,3.25,"x"],"b":{"c":null,"d":false},"e":"AQI="}`
+	opts := Options{BinaryKeyword: "e", Encoder: EncoderOptions{Canonical: true}}
+
+	expected, err := opts.JSONToMessagePack([]byte(input))
+	if err != nil {
+		t.Fatalf("JSONToMessagePack() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := opts.TranscodeJSON(&buf, strings.NewReader(input)); err != nil {
+		t.Fatalf("TranscodeJSON() error = %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("TranscodeJSON() = % X, want % X", buf.Bytes(), expected)
+	}
+}
+
+func TestTranscodeJSONMapping(t *testing.T) {
+	mapping, err := ParseMapping([]string{"ids[] -> uint16", "blob -> bin"})
+	if err != nil {
+		t.Fatalf("ParseMapping() error = %v", err)
+	}
+	opts := Options{Mapping: mapping}
+
+	var buf bytes.Buffer
+	if err := opts.TranscodeJSON(&buf, strings.NewReader(`{"ids": [1], "blob": "AQI="}`)); err != nil {
+		t.Fatalf("TranscodeJSON() error = %v", err)
+	}
+	expected := []byte{0x82, 0xA3, 'i', 'd', 's', 0x91, 0xCD, 0x00, 0x01, 0xA4, 'b', 'l', 'o', 'b', 0xC4, 0x02, 0x01, 0x02}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("TranscodeJSON() = % X, want % X", buf.Bytes(), expected)
+	}
+
+	// a rule matching an object fails like a value of the wrong type
+	if err := opts.TranscodeJSON(io.Discard, strings.NewReader(`{"blob": {}}`)); !errors.Is(err, ErrBinaryDataInvalid) {
+		t.Errorf("TranscodeJSON() error = %v, wantErr %v", err, ErrBinaryDataInvalid)
+	}
+}
+
+func TestTranscodeJSONLarge(t *testing.T) {
+	const n = 100000
+	input := "[" + strings.Repeat(`{"k": 1},`, n-1) + `{"k": 1}]`
+
+	var buf bytes.Buffer
+	if err := TranscodeJSON(&buf, strings.NewReader(input)); err != nil {
+		t.Fatalf("TranscodeJSON() error = %v", err)
+	}
+
+	var decoded []map[string]int
+	if err := Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if len(decoded) != n || decoded[n-1]["k"] != 1 {
+		t.Errorf("TranscodeJSON() decoded to %d elements", len(decoded))
+	}
+}
+
+func TestTranscodeToJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     Options
+		input    []byte
+		expected string
+		wantErr  error
+	}{
+		{name: "entries keep their order", input: []byte{0x82, 0xA1, 'b', 0x01, 0xA1, 'a', 0x02}, expected: `{"b":1,"a":2}`},
+		{name: "scalars", input: []byte{0x96, 0xC0, 0xC2, 0xFF, 0xCA, 0x3F, 0xC0, 0x00, 0x00, 0xCF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xA1, 'x'}, expected: `[null,false,-1,1.5,18446744073709551615,"x"]`},
+		{name: "indent", opts: Options{JSON: JSONOptions{Indent: "  "}}, input: []byte{0x92, 0x01, 0x81, 0xA1, 'a', 0x90}, expected: "[\n  1,\n  {\n    \"a\": []\n  }\n]"},
+		{name: "html escaped", input: []byte{0xA1, '<'}, expected: `"\u003c"`},
+		{name: "html as is", opts: Options{JSON: JSONOptions{DisableHTMLEscape: true}}, input: []byte{0xA1, '<'}, expected: `"<"`},
+		{name: "bin base64", input: []byte{0xC4, 0x02, 0x01, 0x02}, expected: `"AQI="`},
+		{name: "bin hex", opts: Options{JSON: JSONOptions{Bin: BinHex}}, input: []byte{0xC4, 0x02, 0x01, 0x02}, expected: `"0102"`},
+		{name: "bin wrapped", opts: Options{BinaryKeyword: "binary_data", JSON: JSONOptions{Bin: BinWrapped}}, input: []byte{0x91, 0xC4, 0x02, 0x01, 0x02}, expected: `[{"binary_data":"AQI="}]`},
+		{name: "bin wrapped indented", opts: Options{BinaryKeyword: "b", JSON: JSONOptions{Bin: BinWrapped, Indent: "\t"}}, input: []byte{0x91, 0xC4, 0x01, 0x01}, expected: "[\n\t{\n\t\t\"b\": \"AQ==\"\n\t}\n]"},
+		{name: "bin wrapped without keyword", opts: Options{JSON: JSONOptions{Bin: BinWrapped}}, input: []byte{0xC4, 0x01, 0x01}, expected: `"AQ=="`},
+		{name: "NaN", input: []byte{0xCB, 0x7F, 0xF8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01}, wantErr: ErrFloatNotFinite},
+		{name: "NaN as null", opts: Options{JSON: JSONOptions{NonFinite: NonFiniteNull}}, input: []byte{0xCB, 0x7F, 0xF8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01}, expected: `null`},
+		{name: "infinity as string", opts: Options{JSON: JSONOptions{NonFinite: NonFiniteString}}, input: []byte{0x92, 0xCA, 0x7F, 0x80, 0x00, 0x00, 0xCA, 0xFF, 0x80, 0x00, 0x00}, expected: `["Infinity","-Infinity"]`},
+		{name: "int key", input: []byte{0x82, 0x01, 0xC3, 0xFF, 0xC2}, expected: `{"1":true,"-1":false}`},
+		{name: "bool key", input: []byte{0x81, 0xC3, 0x01}, wantErr: ErrUnsupportedType},
+		{name: "int key as string", opts: Options{JSON: JSONOptions{NonStringKeys: KeyString}}, input: []byte{0x82, 0x01, 0xC3, 0xC3, 0x02}, expected: `{"1":true,"true":2}`},
+		{name: "bin key", input: []byte{0x81, 0xC4, 0x01, 'k', 0x01}, expected: `{"k":1}`},
+		{name: "str then bin key", input: []byte{0x82, 0xA1, 'k', 0x01, 0xC4, 0x01, 'k', 0x02}, wantErr: ErrMapKeyCollision},
+		{name: "bin then str key", input: []byte{0x82, 0xC4, 0x01, 'k', 0x01, 0xA1, 'k', 0x02}, wantErr: ErrMapKeyCollision},
+		{name: "same key in nested maps", input: []byte{0x82, 0xA1, 'k', 0x81, 0xC4, 0x01, 'k', 0x01, 0xC4, 0x01, 'j', 0x02}, expected: `{"k":{"k":1},"j":2}`},
+		{name: "timestamp", input: []byte{0xD6, 0xFF, 0x00, 0x00, 0x00, 0x01}, expected: `"1970-01-01T00:00:01Z"`},
+		{name: "empty", input: []byte{}, wantErr: io.ErrUnexpectedEOF},
+		{name: "truncated", input: []byte{0x91, 0xCD, 0x01}, wantErr: io.ErrUnexpectedEOF},
+		{name: "length past the input", input: []byte{0x92, 0x01}, wantErr: ErrLengthExceedsInput},
+		{name: "trailing data", input: []byte{0x01, 0x02}, wantErr: ErrTrailingData},
+		{name: "container limit", opts: Options{Decoder: DecoderOptions{MaxContainerLen: 1}}, input: []byte{0x92, 0x01, 0x02}, wantErr: ErrMaxContainerLenExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := tt.opts.TranscodeToJSON(&buf, bytes.NewReader(tt.input))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("TranscodeToJSON() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && buf.String() != tt.expected {
+				t.Errorf("TranscodeToJSON() = %s, want %s", buf.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestTranscodeToJSONMatchesMessagePackToJSON(t *testing.T) {
+	document, err := JSONToMessagePack([]byte(`{"a":[1,-2,3.25,"x<y"],"b":{"c":null,"d":false},"e":"AQI="}`))
+	if err != nil {
+		t.Fatalf("JSONToMessagePack() error = %v", err)
+	}
+	document, err = Canonicalize(document)
+	if err != nil {
+		t.Fatalf("Canonicalize() error = %v", err)
+	}
+
+	inputs := map[string][]byte{
+		"document": document,
+		// {1: "a", 2: {-3: []}}
+		"int keys": {0x82, 0x01, 0xA1, 'a', 0x02, 0x81, 0xFD, 0x90},
+	}
+	for name, input := range inputs {
+		expected, err := MessagePackToJSON(input)
+		if err != nil {
+			t.Fatalf("%s: MessagePackToJSON() error = %v", name, err)
+		}
+
+		var buf bytes.Buffer
+		if err := TranscodeToJSON(&buf, struct{ io.Reader }{bytes.NewReader(input)}, JSONOptions{}); err != nil {
+			t.Fatalf("%s: TranscodeToJSON() error = %v", name, err)
+		}
+		if buf.String() != expected {
+			t.Errorf("%s: TranscodeToJSON() = %s, want %s", name, buf.String(), expected)
+		}
+	}
+}
+
+func TestTranscodeToJSONDecodeError(t *testing.T) {
+	// [1, {"a": NaN}]
+	input := []byte{0x92, 0x01, 0x81, 0xA1, 'a', 0xCA, 0x7F, 0xC0, 0x00, 0x00}
+
+	err := TranscodeToJSON(io.Discard, bytes.NewReader(input), JSONOptions{})
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("TranscodeToJSON() error = %v, want a *DecodeError", err)
+	}
+	if decodeErr.Path != "[1].a" || decodeErr.Offset != 5 || decodeErr.Format != 0xCA || decodeErr.Err != ErrFloatNotFinite {
+		t.Errorf("TranscodeToJSON() error = %+v", decodeErr)
+	}
+}
+
+func TestTranscodeToJSONMapping(t *testing.T) {
+	mapping, err := ParseMapping([]string{"raw -> ext(5, hex)", "blob -> bin(hex)"})
+	if err != nil {
+		t.Fatalf("ParseMapping() error = %v", err)
+	}
+	opts := Options{Mapping: mapping}
+
+	input := `{"raw":"cafe","blob":"0102"}`
+	var mp bytes.Buffer
+	if err := opts.TranscodeJSON(&mp, strings.NewReader(input)); err != nil {
+		t.Fatalf("TranscodeJSON() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := opts.TranscodeToJSON(&buf, &mp); err != nil {
+		t.Fatalf("TranscodeToJSON() error = %v", err)
+	}
+	if buf.String() != input {
+		t.Errorf("TranscodeToJSON() = %s, want %s", buf.String(), input)
+	}
+}
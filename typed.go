@@ -0,0 +1,710 @@
+package msgpack
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Typed JSON, written and read by the JSON bridge when Options.TypedJSON is
+// set, is plain JSON for the values JSON and MessagePack agree on: nil,
+// bools, strings and integers in the format the encoder would pick anyway,
+// and arrays and maps whose headers are as short as possible. Every other
+// value is an object with a single member whose key names its type:
+//
+//	{"$u16": 1}                            uint 16, likewise $u8 to $u64 and $i8 to $i64
+//	{"$f32": 1.5}                          float 32 and float 64, "7fc00001" for the bits of NaN and infinities
+//	{"$bin": "AQI="}                       bin, base64
+//	{"$ext": {"type": 5, "data": "AQI="}}  ext, data in base64
+//	{"$ts": "2024-07-24T10:00:00Z"}        timestamp extension
+//	{"$str8": "a"}                         str, bin, ext, array and map with a longer header than needed
+//	{"$raw": "2QFh"}                       any value, base64 of its encoding, for strings that are not UTF-8
+//
+// Map keys that are not a plain string, or that start with $, are written as
+// $ followed by their typed JSON, so 1 becomes "$1" and "$x" becomes "$\"$x\"".
+
+// typedFormatTags names the formats a typed JSON object may pin down.
+var typedFormatTags = map[byte]string{
+	0xCC: "$u8", 0xCD: "$u16", 0xCE: "$u32", 0xCF: "$u64",
+	0xD0: "$i8", 0xD1: "$i16", 0xD2: "$i32", 0xD3: "$i64",
+	0xCA: "$f32", 0xCB: "$f64",
+	0xC4: "$bin8", 0xC5: "$bin16", 0xC6: "$bin32",
+	0xD9: "$str8", 0xDA: "$str16", 0xDB: "$str32",
+	0xC7: "$ext8", 0xC8: "$ext16", 0xC9: "$ext32",
+	0xDC: "$array16", 0xDD: "$array32",
+	0xDE: "$map16", 0xDF: "$map32",
+}
+
+// typedTags maps every typed JSON key to the format it pins down, or to
+// zero for the ones that leave the format to the encoder.
+var typedTags = func() map[string]byte {
+	tags := map[string]byte{"$bin": 0, "$ext": 0, "$ts": 0, "$raw": 0}
+	for b, tag := range typedFormatTags {
+		tags[tag] = b
+	}
+	return tags
+}()
+
+// smallestFormat returns the format the encoder picks for a str, bin, ext,
+// array or map of length, b being any format of the same family.
+func smallestFormat(b byte, length int) byte {
+	switch {
+	// str
+	case b >= 0xA0 && b <= 0xBF, b >= 0xD9 && b <= 0xDB:
+		if length <= 0x1F {
+			return 0xA0 | byte(length)
+		}
+		return sizedFormat(0xD9, length)
+
+	// bin
+	case b >= 0xC4 && b <= 0xC6:
+		return sizedFormat(0xC4, length)
+
+	// ext
+	case b >= 0xC7 && b <= 0xC9, b >= 0xD4 && b <= 0xD8:
+		switch length {
+		case 1, 2, 4, 8, 16:
+			return 0xD4 + byte(math.Log2(float64(length)))
+		}
+		return sizedFormat(0xC7, length)
+
+	// array
+	case b >= 0x90 && b <= 0x9F, b == 0xDC, b == 0xDD:
+		if length <= 0x0F {
+			return 0x90 | byte(length)
+		}
+		return sizedFormat(0xDB, length)
+
+	// map
+	case b >= 0x80 && b <= 0x8F, b == 0xDE, b == 0xDF:
+		if length <= 0x0F {
+			return 0x80 | byte(length)
+		}
+		return sizedFormat(0xDD, length)
+	}
+	return b
+}
+
+// sizedFormat picks among the 8, 16 and 32 bit length formats starting at
+// first. Arrays and maps, which have no 8 bit format, pass the one before
+// their 16 bit format.
+func sizedFormat(first byte, length int) byte {
+	switch {
+	case length <= 0xFF && first != 0xDB && first != 0xDD:
+		return first
+	case length <= 0xFFFF:
+		return first + 1
+	}
+	return first + 2
+}
+
+// writeHeader writes format b, one of the str, bin, ext, array and map
+// formats that carry their length, followed by length in the width b takes.
+func writeHeader(w writer, b byte, length int) error {
+	width := 4
+	switch b {
+	case 0xC4, 0xC7, 0xD9:
+		width = 1
+	case 0xC5, 0xC8, 0xDA, 0xDC, 0xDE:
+		width = 2
+	}
+	if length < 0 || uint64(length) >= 1<<(8*width) {
+		return ErrValueOutOfRange
+	}
+
+	header := [5]byte{b}
+	for i := width; i > 0; i-- {
+		header[i] = byte(length)
+		length >>= 8
+	}
+	_, err := w.Write(header[:1+width])
+	return err
+}
+
+// rawHeader returns the bytes format b and length take on the wire.
+func rawHeader(b byte, length int) []byte {
+	if b >= 0x80 && b <= 0xBF || b >= 0xD4 && b <= 0xD8 {
+		return []byte{b}
+	}
+	var buf bytes.Buffer
+	writeHeader(&buf, b, length)
+	return buf.Bytes()
+}
+
+// typedValue transcodes the value introduced by b as typed JSON.
+func (t *msgpackTranscoder) typedValue(b byte) error {
+	dec := t.dec
+
+	length, isMap, isContainer, err := t.dec.readContainerHeader(b)
+	if err != nil {
+		return err
+	}
+	if isContainer {
+		if smallestFormat(b, length) != b {
+			t.openTag(typedFormatTags[b])
+			defer t.w.WriteByte('}')
+		}
+		if isMap {
+			return t.object(length)
+		}
+		return t.array(length)
+	}
+
+	dec.allocated = 0
+
+	switch {
+	// ints in a format the encoder would not pick for them
+	case b >= 0xCC && b <= 0xD3:
+		v, err := dec.decodeFormat(b)
+		if err != nil {
+			return err
+		}
+		var text string
+		var smallest bytes.Buffer
+		if rv := reflect.ValueOf(v); rv.CanUint() {
+			text = strconv.FormatUint(rv.Uint(), 10)
+			encodeUint(&smallest, rv.Uint())
+		} else {
+			text = strconv.FormatInt(rv.Int(), 10)
+			if rv.Int() >= 0 {
+				encodeUint(&smallest, uint64(rv.Int()))
+			} else {
+				encodeInt(&smallest, rv.Int())
+			}
+		}
+		if smallest.Bytes()[0] == b {
+			_, err = t.w.WriteString(text)
+			return err
+		}
+		t.openTag(typedFormatTags[b])
+		t.w.WriteString(text)
+		return t.w.WriteByte('}')
+
+	case b == 0xCA || b == 0xCB:
+		v, err := dec.decodeFormat(b)
+		if err != nil {
+			return err
+		}
+		t.openTag(typedFormatTags[b])
+		if f, ok := v.(float32); ok {
+			if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) {
+				err = t.write(strconv.FormatUint(uint64(math.Float32bits(f)), 16))
+			} else {
+				_, err = t.w.WriteString(strconv.FormatFloat(float64(f), 'g', -1, 32))
+			}
+		} else {
+			f := v.(float64)
+			if math.IsNaN(f) || math.IsInf(f, 0) {
+				err = t.write(strconv.FormatUint(math.Float64bits(f), 16))
+			} else {
+				_, err = t.w.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+			}
+		}
+		if err != nil {
+			return err
+		}
+		return t.w.WriteByte('}')
+
+	// str
+	case b >= 0xA0 && b <= 0xBF, b >= 0xD9 && b <= 0xDB:
+		v, err := dec.decodeFormat(b)
+		if err != nil {
+			return err
+		}
+		s := v.(string)
+		switch {
+		case !utf8.ValidString(s):
+			return t.typedRaw(append(rawHeader(b, len(s)), s...))
+		case smallestFormat(b, len(s)) == b:
+			return t.write(s)
+		}
+		t.openTag(typedFormatTags[b])
+		if err := t.write(s); err != nil {
+			return err
+		}
+		return t.w.WriteByte('}')
+
+	// bin
+	case b >= 0xC4 && b <= 0xC6:
+		v, err := dec.decodeFormat(b)
+		if err != nil {
+			return err
+		}
+		data := v.([]byte)
+		tag := "$bin"
+		if smallestFormat(b, len(data)) != b {
+			tag = typedFormatTags[b]
+		}
+		t.openTag(tag)
+		if err := t.write(data); err != nil {
+			return err
+		}
+		return t.w.WriteByte('}')
+
+	// ext
+	case b >= 0xC7 && b <= 0xC9, b >= 0xD4 && b <= 0xD8:
+		return t.typedExt(b)
+	}
+
+	// nil, bools and fixints
+	v, err := dec.decodeFormat(b)
+	if err != nil {
+		return err
+	}
+	return t.write(v)
+}
+
+// typedExt writes an ext value, as a timestamp when that is what it holds
+// in the layout the encoder would choose.
+func (t *msgpackTranscoder) typedExt(b byte) error {
+	var ext Ext
+	var err error
+	if b >= 0xD4 {
+		ext, err = t.dec.readExt(1 << (b - 0xD4))
+	} else {
+		ext, err = t.dec.readExtWithLengthInBits(8 << (b - 0xC7))
+	}
+	if err != nil {
+		return err
+	}
+
+	if smallestFormat(b, len(ext.Data)) != b {
+		t.openTag(typedFormatTags[b])
+	} else {
+		if ts, ok := typedTimestamp(ext); ok {
+			t.openTag("$ts")
+			if err := t.write(ts); err != nil {
+				return err
+			}
+			return t.w.WriteByte('}')
+		}
+		t.openTag("$ext")
+	}
+
+	t.w.WriteByte('{')
+	t.write("type")
+	t.w.WriteByte(':')
+	t.w.WriteString(strconv.Itoa(int(ext.Type)))
+	t.w.WriteByte(',')
+	t.write("data")
+	t.w.WriteByte(':')
+	if err := t.write(ext.Data); err != nil {
+		return err
+	}
+	_, err = t.w.WriteString("}}")
+	return err
+}
+
+// typedTimestamp returns the RFC 3339 form of a timestamp extension, if
+// reading that form back gives the same bytes.
+func typedTimestamp(ext Ext) (string, bool) {
+	if ext.Type != timestampExtType {
+		return "", false
+	}
+	ts, err := decodeTimestamp(ext.Data)
+	if err != nil || ts.Year() < 0 || ts.Year() > 9999 {
+		return "", false
+	}
+
+	var original, encoded bytes.Buffer
+	encodeExt(&original, ext.Type, ext.Data)
+	encodeTimestamp(&encoded, ts)
+	if !bytes.Equal(original.Bytes(), encoded.Bytes()) {
+		return "", false
+	}
+	return ts.Format(time.RFC3339Nano), true
+}
+
+func (t *msgpackTranscoder) typedRaw(raw []byte) error {
+	t.openTag("$raw")
+	if err := t.write(raw); err != nil {
+		return err
+	}
+	return t.w.WriteByte('}')
+}
+
+// openTag starts the object a typed value is wrapped in.
+func (t *msgpackTranscoder) openTag(tag string) {
+	t.w.WriteByte('{')
+	t.write(tag)
+	t.w.WriteByte(':')
+}
+
+// typedKey reads the next map key and returns the string it is written as.
+func (t *msgpackTranscoder) typedKey() (string, error) {
+	w, indent := t.w, t.opts.JSON.Indent
+	var buf bytes.Buffer
+	t.w, t.opts.JSON.Indent = &buf, ""
+	err := t.value()
+	t.w, t.opts.JSON.Indent = w, indent
+	if err != nil {
+		return "", err
+	}
+
+	text := buf.Bytes()
+	if text[0] == '"' && text[1] != '$' {
+		var key string
+		err := json.Unmarshal(text, &key)
+		return key, err
+	}
+	return "$" + string(text), nil
+}
+
+// readTypedJSON reads one typed JSON value from src and writes it to w as
+// MessagePack.
+func (o Options) readTypedJSON(w writer, src io.Reader) error {
+	dec := json.NewDecoder(src)
+	dec.UseNumber()
+
+	es := newEncodeState(w, o.Encoder)
+	es.bigInt = o.BigInt
+
+	r := &typedJSONReader{dec: dec, es: es, held: &heldOutput{}}
+	if err := r.value(w); err != nil {
+		return err
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		if err == nil {
+			return ErrTrailingData
+		}
+		return err
+	}
+	return nil
+}
+
+// typedJSONReader turns typed JSON back into MessagePack. Arrays and maps
+// are held in memory until the outermost one closes, since their length
+// comes first.
+type typedJSONReader struct {
+	dec  *json.Decoder
+	es   *encodeState
+	held *heldOutput
+}
+
+func (r *typedJSONReader) token() (json.Token, error) {
+	tok, err := r.dec.Token()
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return tok, err
+}
+
+func (r *typedJSONReader) value(w writer) error {
+	tok, err := r.token()
+	if err != nil {
+		return err
+	}
+	return r.valueFrom(w, tok)
+}
+
+func (r *typedJSONReader) valueFrom(w writer, tok json.Token) error {
+	switch tok {
+	case json.Delim('['):
+		return r.array(w, 0)
+
+	case json.Delim('{'):
+		first, err := r.token()
+		if err != nil {
+			return err
+		}
+		if key, ok := first.(string); ok {
+			if format, ok := typedTags[key]; ok {
+				return r.tagged(w, key, format)
+			}
+		}
+		return r.entries(w, 0, first)
+	}
+
+	r.es.buf = w
+	return r.es.encode(tok)
+}
+
+// array reads the elements of an array and writes them after a header in
+// format, or in the smallest one when format is zero.
+func (r *typedJSONReader) array(w writer, format byte) error {
+	header := r.held.open(w, false, format)
+	n := 0
+	for {
+		tok, err := r.token()
+		if err != nil {
+			return err
+		}
+		if tok == json.Delim(']') {
+			break
+		}
+		if err := r.valueFrom(r.held.writer(), tok); err != nil {
+			return err
+		}
+		n++
+	}
+	return r.held.close(header, n)
+}
+
+// entries reads the members of an object, starting with tok if the first
+// token was already read, and writes them like array does.
+func (r *typedJSONReader) entries(w writer, format byte, tok json.Token) error {
+	header := r.held.open(w, true, format)
+	n := 0
+	for ; ; n++ {
+		if tok == nil {
+			var err error
+			if tok, err = r.token(); err != nil {
+				return err
+			}
+		}
+		if tok == json.Delim('}') {
+			break
+		}
+
+		if err := r.key(r.held.writer(), tok.(string)); err != nil {
+			return err
+		}
+		if err := r.value(r.held.writer()); err != nil {
+			return err
+		}
+		tok = nil
+	}
+	return r.held.close(header, n)
+}
+
+func (r *typedJSONReader) key(w writer, key string) error {
+	if !strings.HasPrefix(key, "$") {
+		return encodeString(w, key)
+	}
+
+	dec := json.NewDecoder(strings.NewReader(key[1:]))
+	dec.UseNumber()
+	sub := &typedJSONReader{dec: dec, es: r.es, held: r.held}
+	if err := sub.value(w); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return ErrTypedJSONInvalid
+	}
+	return nil
+}
+
+// tagged reads the value of a typed JSON object and its closing brace.
+func (r *typedJSONReader) tagged(w writer, tag string, format byte) error {
+	var err error
+	switch tag {
+	case "$bin", "$bin8", "$bin16", "$bin32":
+		var data []byte
+		if data, err = r.base64(); err != nil {
+			return err
+		}
+		if format == 0 {
+			err = encodeBin(w, data)
+		} else if err = writeHeader(w, format, len(data)); err == nil {
+			_, err = w.Write(data)
+		}
+
+	case "$str8", "$str16", "$str32":
+		var s string
+		if s, err = r.string(); err != nil {
+			return err
+		}
+		if err = writeHeader(w, format, len(s)); err == nil {
+			_, err = w.WriteString(s)
+		}
+
+	case "$ext", "$ext8", "$ext16", "$ext32":
+		err = r.ext(w, format)
+
+	case "$ts":
+		var s string
+		if s, err = r.string(); err != nil {
+			return err
+		}
+		ts, perr := time.Parse(time.RFC3339Nano, s)
+		if perr != nil {
+			return ErrTimestampInvalid
+		}
+		err = encodeTimestamp(w, ts)
+
+	case "$raw":
+		var data []byte
+		if data, err = r.base64(); err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+
+	case "$array16", "$array32":
+		var tok json.Token
+		if tok, err = r.token(); err != nil {
+			return err
+		}
+		if tok != json.Delim('[') {
+			return ErrTypedJSONInvalid
+		}
+		err = r.array(w, format)
+
+	case "$map16", "$map32":
+		var tok json.Token
+		if tok, err = r.token(); err != nil {
+			return err
+		}
+		if tok != json.Delim('{') {
+			return ErrTypedJSONInvalid
+		}
+		err = r.entries(w, format, nil)
+
+	default:
+		err = r.number(w, format)
+	}
+	if err != nil {
+		return err
+	}
+
+	tok, err := r.token()
+	if err != nil {
+		return err
+	}
+	if tok != json.Delim('}') {
+		return ErrTypedJSONInvalid
+	}
+	return nil
+}
+
+// number reads an int or float pinned to format. Floats may also be given
+// as the hex string of their bits.
+func (r *typedJSONReader) number(w writer, format byte) error {
+	tok, err := r.token()
+	if err != nil {
+		return err
+	}
+
+	var c conversion
+	switch {
+	case format >= 0xCC && format <= 0xCF:
+		c = conversion{kind: convUint, bits: 8 << (format - 0xCC)}
+	case format >= 0xD0 && format <= 0xD3:
+		c = conversion{kind: convInt, bits: 8 << (format - 0xD0)}
+	default:
+		c = conversion{kind: convFloat, bits: 32 << (format - 0xCA)}
+	}
+
+	switch v := tok.(type) {
+	case json.Number:
+		raw, err := c.encodeNumber(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(raw)
+		return err
+
+	case string:
+		if c.kind != convFloat {
+			return ErrTypedJSONInvalid
+		}
+		bits, err := strconv.ParseUint(v, 16, c.bits)
+		if err != nil {
+			return ErrTypedJSONInvalid
+		}
+		raw := make([]byte, 1+c.bits/8)
+		raw[0] = format
+		for i := len(raw) - 1; i > 0; i-- {
+			raw[i] = byte(bits)
+			bits >>= 8
+		}
+		_, err = w.Write(raw)
+		return err
+	}
+	return ErrTypedJSONInvalid
+}
+
+// ext reads the {"type": n, "data": "..."} object of an ext value.
+func (r *typedJSONReader) ext(w writer, format byte) error {
+	tok, err := r.token()
+	if err != nil {
+		return err
+	}
+	if tok != json.Delim('{') {
+		return ErrTypedJSONInvalid
+	}
+
+	var extType int64
+	var data []byte
+	var haveType, haveData bool
+	for {
+		tok, err := r.token()
+		if err != nil {
+			return err
+		}
+		if tok == json.Delim('}') {
+			break
+		}
+
+		switch tok {
+		case "type":
+			tok, err := r.token()
+			if err != nil {
+				return err
+			}
+			n, ok := tok.(json.Number)
+			if !ok {
+				return ErrTypedJSONInvalid
+			}
+			if extType, err = strconv.ParseInt(string(n), 10, 8); err != nil {
+				return ErrTypedJSONInvalid
+			}
+			haveType = true
+
+		case "data":
+			if data, err = r.base64(); err != nil {
+				return err
+			}
+			haveData = true
+
+		default:
+			return ErrTypedJSONInvalid
+		}
+	}
+	if !haveType || !haveData {
+		return ErrTypedJSONInvalid
+	}
+
+	if format == 0 {
+		return encodeExt(w, int8(extType), data)
+	}
+	if err := writeHeader(w, format, len(data)); err != nil {
+		return err
+	}
+	if err := w.WriteByte(byte(extType)); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (r *typedJSONReader) string() (string, error) {
+	tok, err := r.token()
+	if err != nil {
+		return "", err
+	}
+	s, ok := tok.(string)
+	if !ok {
+		return "", ErrTypedJSONInvalid
+	}
+	return s, nil
+}
+
+func (r *typedJSONReader) base64() ([]byte, error) {
+	s, err := r.string()
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrBinaryDataInvalid
+	}
+	return data, nil
+}
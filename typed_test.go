@@ -0,0 +1,119 @@
+package msgpack
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTypedJSONRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []byte
+		expected string
+	}{
+		{name: "plain values", input: []byte{0x93, 0x01, 0xFF, 0xA1, 'a'}, expected: `[1,-1,"a"]`},
+		{name: "nil and bools", input: []byte{0x93, 0xC0, 0xC2, 0xC3}, expected: `[null,false,true]`},
+		{name: "smallest uint", input: []byte{0xCC, 0xC8}, expected: `200`},
+		{name: "uint 16 holding 1", input: []byte{0xCD, 0x00, 0x01}, expected: `{"$u16":1}`},
+		{name: "int 64 holding -1", input: []byte{0xD3, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, expected: `{"$i64":-1}`},
+		{name: "uint 64", input: []byte{0xCF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, expected: `18446744073709551615`},
+		{name: "float 32", input: []byte{0xCA, 0x3F, 0xC0, 0x00, 0x00}, expected: `{"$f32":1.5}`},
+		{name: "float 64 holding 1", input: []byte{0xCB, 0x3F, 0xF0, 0, 0, 0, 0, 0, 0}, expected: `{"$f64":1}`},
+		{name: "float 32 NaN", input: []byte{0xCA, 0x7F, 0xC0, 0x00, 0x01}, expected: `{"$f32":"7fc00001"}`},
+		{name: "float 64 infinity", input: []byte{0xCB, 0xFF, 0xF0, 0, 0, 0, 0, 0, 0}, expected: `{"$f64":"fff0000000000000"}`},
+		{name: "bin", input: []byte{0xC4, 0x02, 0x01, 0x02}, expected: `{"$bin":"AQI="}`},
+		{name: "bin 16", input: []byte{0xC5, 0x00, 0x01, 0xFF}, expected: `{"$bin16":"/w=="}`},
+		{name: "str 8", input: []byte{0xD9, 0x01, 'a'}, expected: `{"$str8":"a"}`},
+		{name: "invalid UTF-8", input: []byte{0xA1, 0xFF}, expected: `{"$raw":"of8="}`},
+		{name: "fixext", input: []byte{0xD5, 0x05, 0x01, 0x02}, expected: `{"$ext":{"type":5,"data":"AQI="}}`},
+		{name: "ext 8 of 2 bytes", input: []byte{0xC7, 0x02, 0x05, 0x01, 0x02}, expected: `{"$ext8":{"type":5,"data":"AQI="}}`},
+		{name: "timestamp", input: []byte{0xD6, 0xFF, 0x00, 0x00, 0x00, 0x01}, expected: `{"$ts":"1970-01-01T00:00:01Z"}`},
+		{name: "timestamp 96 holding seconds", input: []byte{0xC7, 0x0C, 0xFF, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x01}, expected: `{"$ext":{"type":-1,"data":"AAAAAAAAAAAAAAAB"}}`},
+		{name: "array 16", input: []byte{0xDC, 0x00, 0x01, 0x01}, expected: `{"$array16":[1]}`},
+		{name: "map 32", input: []byte{0xDF, 0x00, 0x00, 0x00, 0x01, 0xA1, 'a', 0x01}, expected: `{"$map32":{"a":1}}`},
+		{name: "int key", input: []byte{0x81, 0x01, 0xA1, 'a'}, expected: `{"$1":"a"}`},
+		{name: "dollar key", input: []byte{0x81, 0xA2, '$', 'x', 0xC0}, expected: `{"$\"$x\"":null}`},
+		{name: "tagged key", input: []byte{0x81, 0xCD, 0x00, 0x01, 0xC0}, expected: `{"${\"$u16\":1}":null}`},
+		{name: "nested", input: []byte{0x81, 0xA1, 'a', 0x92, 0xD0, 0x01, 0x90}, expected: `{"a":[{"$i8":1},[]]}`},
+		{name: "nested sized containers", input: []byte{0xDC, 0x00, 0x02, 0x91, 0x01, 0xDE, 0x00, 0x01, 0xA1, 'a', 0x90}, expected: `{"$array16":[[1],{"$map16":{"a":[]}}]}`},
+		{name: "array key", input: []byte{0x92, 0x81, 0x92, 0x01, 0x90, 0xC0, 0x02}, expected: `[{"$[1,[]]":null},2]`},
+	}
+	opts := Options{TypedJSON: true}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			js, err := opts.MessagePackToJSON(tt.input)
+			if err != nil {
+				t.Fatalf("MessagePackToJSON() error = %v", err)
+			}
+			if js != tt.expected {
+				t.Errorf("MessagePackToJSON() = %s, want %s", js, tt.expected)
+			}
+
+			mp, err := opts.JSONToMessagePack([]byte(js))
+			if err != nil {
+				t.Fatalf("JSONToMessagePack() error = %v", err)
+			}
+			if !bytes.Equal(mp, tt.input) {
+				t.Errorf("JSONToMessagePack() = % X, want % X", mp, tt.input)
+			}
+
+			var buf bytes.Buffer
+			if err := opts.TranscodeJSON(&buf, strings.NewReader(js)); err != nil {
+				t.Fatalf("TranscodeJSON() error = %v", err)
+			}
+			if !bytes.Equal(buf.Bytes(), tt.input) {
+				t.Errorf("TranscodeJSON() = % X, want % X", buf.Bytes(), tt.input)
+			}
+		})
+	}
+}
+
+func TestTypedJSONIndent(t *testing.T) {
+	opts := Options{TypedJSON: true, JSON: JSONOptions{Indent: "  "}}
+	input := []byte{0x82, 0x01, 0x90, 0xA1, 'a', 0x91, 0xCD, 0x00, 0x01}
+
+	var sb strings.Builder
+	if err := opts.TranscodeToJSON(&sb, bytes.NewReader(input)); err != nil {
+		t.Fatalf("TranscodeToJSON() error = %v", err)
+	}
+	expected := "{\n  \"$1\": [],\n  \"a\": [\n    {\"$u16\":1}\n  ]\n}"
+	if sb.String() != expected {
+		t.Errorf("TranscodeToJSON() = %q, want %q", sb.String(), expected)
+	}
+
+	mp, err := opts.JSONToMessagePack([]byte(sb.String()))
+	if err != nil {
+		t.Fatalf("JSONToMessagePack() error = %v", err)
+	}
+	if !bytes.Equal(mp, input) {
+		t.Errorf("JSONToMessagePack() = % X, want % X", mp, input)
+	}
+}
+
+func TestTypedJSONInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{name: "extra member", input: `{"$u16": 1, "a": 2}`, wantErr: ErrTypedJSONInvalid},
+		{name: "string for int", input: `{"$u8": "1"}`, wantErr: ErrTypedJSONInvalid},
+		{name: "int out of range", input: `{"$u8": 256}`, wantErr: ErrValueOutOfRange},
+		{name: "array tag on object", input: `{"$array16": {}}`, wantErr: ErrTypedJSONInvalid},
+		{name: "ext without data", input: `{"$ext": {"type": 1}}`, wantErr: ErrTypedJSONInvalid},
+		{name: "bad base64", input: `{"$bin": "!"}`, wantErr: ErrBinaryDataInvalid},
+		{name: "bad timestamp", input: `{"$ts": "yesterday"}`, wantErr: ErrTimestampInvalid},
+		{name: "bad key", input: `{"$1 2": null}`, wantErr: ErrTypedJSONInvalid},
+		{name: "trailing data", input: `1 2`, wantErr: ErrTrailingData},
+	}
+	opts := Options{TypedJSON: true}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := opts.JSONToMessagePack([]byte(tt.input)); !errors.Is(err, tt.wantErr) {
+				t.Errorf("JSONToMessagePack() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
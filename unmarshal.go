@@ -0,0 +1,459 @@
+package msgpack
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// Unmarshal decodes the MessagePack value in data into the value pointed to
+// by v.
+//
+// Maps decode into structs by matching keys against the `msgpack` tag or
+// field name, falling back to a case-insensitive match. Numbers convert to
+// any numeric kind that can hold them; values that do not fit the target
+// return ErrValueOutOfRange.
+func Unmarshal(data []byte, v interface{}) error {
+	return Options{}.Unmarshal(data, v)
+}
+
+// Unmarshal is like the package-level Unmarshal but decodes with o.Decoder.
+// Data after the value fails with ErrTrailingData.
+func (o Options) Unmarshal(data []byte, v interface{}) error {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Pointer || value.IsNil() {
+		return ErrInvalidUnmarshal
+	}
+
+	dec := NewDecoderWithOptions(bytes.NewReader(data), o.Decoder)
+	if err := dec.decodeValue(value.Elem()); err != nil {
+		return newDecodeError(err, 0, 0)
+	}
+
+	if b, offset, err := dec.readFormat(); err != io.EOF {
+		if err == nil {
+			err = &DecodeError{Offset: offset, Format: b, Err: ErrTrailingData}
+		}
+		return err
+	}
+	return nil
+}
+
+func (dec *MessagePackDecoder) decodeValue(value reflect.Value) (err error) {
+	b, offset, err := dec.readFormat()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			err = newDecodeError(err, offset, b)
+		}
+	}()
+
+	// nil resets the target, including pointers and maps
+	if b == 0xC0 {
+		value.SetZero()
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.Pointer:
+		if value.IsNil() {
+			value.Set(reflect.New(value.Type().Elem()))
+		}
+		dec.reader.UnreadByte()
+		return dec.decodeValue(value.Elem())
+
+	case reflect.Interface:
+		// decode into the concrete value a non-empty interface already points to
+		if value.NumMethod() > 0 {
+			if value.IsNil() || value.Elem().Kind() != reflect.Pointer {
+				return ErrUnsupportedType
+			}
+			dec.reader.UnreadByte()
+			return dec.decodeValue(value.Elem())
+		}
+
+		dec.reader.UnreadByte()
+		data, err := dec.decode()
+		if err != nil {
+			return err
+		}
+		if data == nil {
+			value.SetZero()
+		} else {
+			value.Set(reflect.ValueOf(data))
+		}
+		return nil
+	}
+
+	dec.traceTarget(offset, b, value.Type())
+
+	switch {
+	// fixmap
+	case b >= 0x80 && b <= 0x8F:
+		return dec.decodeMapValue(value, int(b&0x0F))
+
+	// map 16, map 32
+	case b == 0xDE || b == 0xDF:
+		length, err := dec.readLength(16 << (b - 0xDE))
+		if err != nil {
+			return err
+		}
+		return dec.decodeMapValue(value, int(length))
+
+	// fixarray
+	case b >= 0x90 && b <= 0x9F:
+		return dec.decodeArrayValue(value, int(b&0x0F))
+
+	// array 16, array 32
+	case b == 0xDC || b == 0xDD:
+		length, err := dec.readLength(16 << (b - 0xDC))
+		if err != nil {
+			return err
+		}
+		return dec.decodeArrayValue(value, int(length))
+	}
+
+	dec.reader.UnreadByte()
+	data, err := dec.decode()
+	if err != nil {
+		return err
+	}
+
+	return setScalar(value, data)
+}
+
+func (dec *MessagePackDecoder) decodeArrayValue(value reflect.Value, length int) error {
+	if err := dec.enterContainer(length, 1); err != nil {
+		return err
+	}
+	defer dec.leaveContainer()
+
+	switch value.Kind() {
+	case reflect.Slice:
+		if value.IsNil() || value.Cap() < length {
+			n := dec.capHint(length)
+			value.Set(reflect.MakeSlice(value.Type(), n, n))
+		} else {
+			value.SetLen(length)
+		}
+
+	case reflect.Array:
+		// elements beyond the array length are decoded and dropped below,
+		// missing ones are zeroed
+		for i := length; i < value.Len(); i++ {
+			value.Index(i).SetZero()
+		}
+
+	default:
+		return ErrUnsupportedType
+	}
+
+	for i := 0; i < length; i++ {
+		// slices not preallocated in full grow as elements arrive
+		if value.Kind() == reflect.Slice && i >= value.Len() {
+			value.Set(reflect.Append(value, reflect.Zero(value.Type().Elem())))
+		}
+
+		if i >= value.Len() {
+			if _, err := dec.decode(); err != nil {
+				return withIndex(err, i)
+			}
+			continue
+		}
+
+		if err := dec.decodeValue(value.Index(i)); err != nil {
+			return withIndex(err, i)
+		}
+	}
+
+	return nil
+}
+
+func (dec *MessagePackDecoder) decodeMapValue(value reflect.Value, length int) error {
+	if value.Kind() != reflect.Struct && value.Kind() != reflect.Map {
+		return ErrUnsupportedType
+	}
+
+	if err := dec.enterContainer(length, 2); err != nil {
+		return err
+	}
+	defer dec.leaveContainer()
+
+	if value.Kind() == reflect.Struct {
+		return dec.decodeStructValue(value, length)
+	}
+
+	if value.IsNil() {
+		value.Set(reflect.MakeMapWithSize(value.Type(), dec.capHint(length)))
+	}
+
+	keyType := value.Type().Key()
+	elemType := value.Type().Elem()
+	var binKeys binKeySet
+
+	for i := 0; i < length; i++ {
+		b, _, err := dec.readFormat()
+		if err != nil {
+			return err
+		}
+		dec.reader.UnreadByte()
+		fromBin := b >= 0xC4 && b <= 0xC6
+
+		key := reflect.New(keyType).Elem()
+		if err := dec.decodeValue(key); err != nil {
+			return err
+		}
+
+		// interface keys hold whatever Decode returned, which may not be
+		// hashable
+		if keyType.Kind() == reflect.Interface && !key.IsNil() {
+			k, err := mapKey(key.Elem().Interface())
+			if err != nil {
+				return err
+			}
+			key.Set(reflect.ValueOf(k))
+		}
+
+		var keyStr string
+		var isStr bool
+		switch key.Kind() {
+		case reflect.String:
+			keyStr, isStr = key.String(), true
+		case reflect.Interface:
+			keyStr, isStr = key.Interface().(string)
+		}
+		if isStr {
+			if err := binKeys.add(keyStr, fromBin, value.MapIndex(key).IsValid()); err != nil {
+				return err
+			}
+		}
+
+		elem := reflect.New(elemType).Elem()
+		if err := dec.decodeValue(elem); err != nil {
+			return withKey(err, key.Interface())
+		}
+
+		value.SetMapIndex(key, elem)
+	}
+
+	return nil
+}
+
+func (dec *MessagePackDecoder) decodeStructValue(value reflect.Value, length int) error {
+	fields := cachedFields(value.Type())
+
+	for i := 0; i < length; i++ {
+		key, err := dec.decode()
+		if err != nil {
+			return err
+		}
+
+		keyStr, ok := key.(string)
+		if !ok {
+			return ErrUnsupportedType
+		}
+
+		f := lookupField(fields, keyStr)
+		if f == nil {
+			// unknown keys are skipped
+			if _, err := dec.decode(); err != nil {
+				return withKey(err, keyStr)
+			}
+			continue
+		}
+
+		// like encoding/json, a field behind a nil pointer to an unexported
+		// embedded struct cannot be set
+		fv, ok := fieldByIndexAlloc(value, f.index)
+		if !ok {
+			return withKey(ErrUnsettableEmbedded, keyStr)
+		}
+
+		if err := dec.decodeValue(fv); err != nil {
+			return withKey(err, keyStr)
+		}
+	}
+
+	return nil
+}
+
+// lookupField prefers an exact name match over a case-insensitive one.
+func lookupField(fields []field, name string) *field {
+	var fold *field
+	for i := range fields {
+		if fields[i].name == name {
+			return &fields[i]
+		}
+		if fold == nil && strings.EqualFold(fields[i].name, name) {
+			fold = &fields[i]
+		}
+	}
+	return fold
+}
+
+// fieldByIndexAlloc is like fieldByIndex but allocates nil embedded pointers
+// along the way. It reports false if such a pointer cannot be set.
+func fieldByIndexAlloc(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// setScalar stores a value produced by Decode into target, converting
+// between numeric kinds where the value fits.
+func setScalar(target reflect.Value, data interface{}) error {
+	source := reflect.ValueOf(data)
+
+	// values such as Ext or registered extension types land in a target
+	// of their own type
+	if source.IsValid() && source.Type().AssignableTo(target.Type()) {
+		target.Set(source)
+		return nil
+	}
+	if source.Kind() == reflect.Pointer && !source.IsNil() && source.Elem().Type().AssignableTo(target.Type()) {
+		target.Set(source.Elem())
+		return nil
+	}
+
+	switch target.Kind() {
+	case reflect.Bool:
+		if source.Kind() == reflect.Bool {
+			target.SetBool(source.Bool())
+			return nil
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := toInt64(source)
+		if err != nil {
+			return err
+		}
+		if target.OverflowInt(n) {
+			return ErrValueOutOfRange
+		}
+		target.SetInt(n)
+		return nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := toUint64(source)
+		if err != nil {
+			return err
+		}
+		if target.OverflowUint(n) {
+			return ErrValueOutOfRange
+		}
+		target.SetUint(n)
+		return nil
+
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		switch source.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			f = float64(source.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			f = float64(source.Uint())
+		case reflect.Float32, reflect.Float64:
+			f = source.Float()
+		default:
+			return ErrUnsupportedType
+		}
+		if target.OverflowFloat(f) {
+			return ErrValueOutOfRange
+		}
+		target.SetFloat(f)
+		return nil
+
+	case reflect.String:
+		switch v := data.(type) {
+		case string:
+			target.SetString(v)
+			return nil
+		case []byte:
+			target.SetString(string(v))
+			return nil
+		}
+
+	case reflect.Slice:
+		if target.Type().Elem().Kind() == reflect.Uint8 {
+			switch v := data.(type) {
+			case []byte:
+				target.SetBytes(v)
+				return nil
+			case string:
+				target.SetBytes([]byte(v))
+				return nil
+			}
+		}
+
+	case reflect.Array:
+		// like arrays decoded from an array, extra bytes are dropped and
+		// missing ones zeroed
+		if v, ok := data.([]byte); ok && target.Type().Elem().Kind() == reflect.Uint8 {
+			n := reflect.Copy(target, reflect.ValueOf(v))
+			for i := n; i < target.Len(); i++ {
+				target.Index(i).SetZero()
+			}
+			return nil
+		}
+	}
+
+	return ErrUnsupportedType
+}
+
+func toInt64(source reflect.Value) (int64, error) {
+	switch source.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return source.Int(), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if source.Uint() > math.MaxInt64 {
+			return 0, ErrValueOutOfRange
+		}
+		return int64(source.Uint()), nil
+
+	case reflect.Float32, reflect.Float64:
+		f := source.Float()
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return 0, ErrValueOutOfRange
+		}
+		return int64(f), nil
+	}
+
+	return 0, ErrUnsupportedType
+}
+
+func toUint64(source reflect.Value) (uint64, error) {
+	switch source.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if source.Int() < 0 {
+			return 0, ErrValueOutOfRange
+		}
+		return uint64(source.Int()), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return source.Uint(), nil
+
+	case reflect.Float32, reflect.Float64:
+		f := source.Float()
+		if f != math.Trunc(f) || f < 0 || f >= math.MaxUint64 {
+			return 0, ErrValueOutOfRange
+		}
+		return uint64(f), nil
+	}
+
+	return 0, ErrUnsupportedType
+}
@@ -0,0 +1,151 @@
+package msgpack
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestUnmarshal(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []byte
+		target   interface{}
+		expected interface{}
+		wantErr  error
+	}{
+		{name: "uint8 into int", input: []byte{0x7F}, target: new(int), expected: 127},
+		{name: "int8 into int64", input: []byte{0xFF}, target: new(int64), expected: int64(-1)},
+		{name: "uint16 into uint8 overflow", input: []byte{0xCD, 0x01, 0x00}, target: new(uint8), wantErr: ErrValueOutOfRange},
+		{name: "negative into uint", input: []byte{0xFF}, target: new(uint), wantErr: ErrValueOutOfRange},
+		{name: "uint64 into int64 overflow", input: []byte{0xCF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, target: new(int64), wantErr: ErrValueOutOfRange},
+		{name: "int into float64", input: []byte{0xD0, 0x80}, target: new(float64), expected: float64(-128)},
+		{name: "float32 into float64", input: []byte{0xCA, 0x3F, 0x80, 0x00, 0x00}, target: new(float64), expected: float64(1)},
+		{name: "float64 into float32 overflow", input: []byte{0xCB, 0x7F, 0xEF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, target: new(float32), wantErr: ErrValueOutOfRange},
+		{name: "integral float into int", input: []byte{0xCB, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, target: new(int), expected: 2},
+		{name: "fractional float into int", input: []byte{0xCA, 0x3F, 0xC0, 0x00, 0x00}, target: new(int), wantErr: ErrValueOutOfRange},
+		{name: "string", input: []byte{0xA3, 'f', 'o', 'o'}, target: new(string), expected: "foo"},
+		{name: "bin into bytes", input: []byte{0xC4, 0x02, 0x01, 0x02}, target: new([]byte), expected: []byte{0x01, 0x02}},
+		{name: "bin into byte array", input: []byte{0xC4, 0x02, 0x01, 0x02}, target: new([3]byte), expected: [3]byte{0x01, 0x02, 0x00}},
+		{name: "string into bool", input: []byte{0xA1, 'x'}, target: new(bool), wantErr: ErrUnsupportedType},
+		{name: "typed slice", input: []byte{0x93, 0x01, 0x02, 0x03}, target: new([]uint16), expected: []uint16{1, 2, 3}},
+		{name: "array drops extra", input: []byte{0x93, 0x01, 0x02, 0x03}, target: new([2]int), expected: [2]int{1, 2}},
+		{name: "typed map", input: []byte{0x81, 0xA1, 'a', 0x01}, target: new(map[string]int8), expected: map[string]int8{"a": 1}},
+		{name: "int keyed map", input: []byte{0x82, 0x01, 0xA1, 'a', 0xFF, 0xA1, 'b'}, target: new(map[int]string), expected: map[int]string{1: "a", -1: "b"}},
+		{name: "bool keyed map", input: []byte{0x81, 0xC3, 0x01}, target: new(map[bool]uint8), expected: map[bool]uint8{true: 1}},
+		{name: "bin key into interface map", input: []byte{0x81, 0xC4, 0x01, 'k', 0x01}, target: new(map[interface{}]int), expected: map[interface{}]int{"k": 1}},
+		{name: "string key into int map", input: []byte{0x81, 0xA1, 'a', 0x01}, target: new(map[int]int), wantErr: ErrUnsupportedType},
+		{name: "nil into slice", input: []byte{0xC0}, target: &[]int{1}, expected: []int(nil)},
+		{name: "interface", input: []byte{0x91, 0xC3}, target: new(interface{}), expected: []interface{}{true}},
+		{name: "pointer", input: []byte{0x05}, target: new(*int), expected: func() *int { n := 5; return &n }()},
+		{name: "array into map", input: []byte{0x90}, target: new(map[string]int), wantErr: ErrUnsupportedType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Unmarshal(tt.input, tt.target)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			got := reflect.ValueOf(tt.target).Elem().Interface()
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Unmarshal() = %#v, want %#v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestUnmarshalStruct(t *testing.T) {
+	input := []byte{
+		0x86,
+		0xA2, 'i', 'd', 0xA2, 'r', '1',
+		0xA4, 'N', 'A', 'M', 'E', 0xA6, 'r', 'e', 'c', 'o', 'r', 'd',
+		0xA4, 't', 'a', 'g', 's', 0x91, 0xA1, 'a',
+		0xA5, 'p', 'o', 'i', 'n', 't', 0x81, 0xA1, 'x', 0x03,
+		0xA7, 'u', 'n', 'k', 'n', 'o', 'w', 'n', 0x92, 0x01, 0x02,
+		0xA5, 'a', 't', 't', 'r', 's', 0x81, 0xA1, 'k', 0xCD, 0x01, 0x00,
+	}
+	expected := testRecord{
+		testEmbedded: testEmbedded{ID: "r1"},
+		Name:         "record",
+		Tags:         []string{"a"},
+		Point:        &testPoint{X: 3},
+		Attrs:        map[string]uint16{"k": 256},
+	}
+
+	var record testRecord
+	if err := Unmarshal(input, &record); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if !reflect.DeepEqual(record, expected) {
+		t.Errorf("Unmarshal() = %+v, want %+v", record, expected)
+	}
+}
+
+func TestUnmarshalRoundTrip(t *testing.T) {
+	record := testRecord{
+		testEmbedded: testEmbedded{ID: "r2"},
+		Name:         "round trip",
+		Tags:         []string{"x", "y"},
+		Point:        &testPoint{X: -1, Y: 70000},
+		Attrs:        map[string]uint16{"a": 1, "b": 65535},
+	}
+
+	encoded, err := Marshal(record)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	var decoded testRecord
+	if err := Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if !reflect.DeepEqual(decoded, record) {
+		t.Errorf("Unmarshal() = %+v, want %+v", decoded, record)
+	}
+}
+
+func TestUnmarshalInvalidTarget(t *testing.T) {
+	var n int
+	if err := Unmarshal([]byte{0x01}, n); err != ErrInvalidUnmarshal {
+		t.Errorf("Unmarshal() error = %v, wantErr %v", err, ErrInvalidUnmarshal)
+	}
+	if err := Unmarshal([]byte{0x01}, (*int)(nil)); err != ErrInvalidUnmarshal {
+		t.Errorf("Unmarshal() error = %v, wantErr %v", err, ErrInvalidUnmarshal)
+	}
+}
+
+func TestUnmarshalTrailingData(t *testing.T) {
+	var n int
+	err := Unmarshal([]byte{0x01, 0x02}, &n)
+
+	var de *DecodeError
+	if !errors.As(err, &de) || !errors.Is(err, ErrTrailingData) {
+		t.Fatalf("Unmarshal() error = %v, want a DecodeError for %v", err, ErrTrailingData)
+	}
+	if de.Offset != 1 || de.Format != 0x02 {
+		t.Errorf("Unmarshal() error at offset %d format %#x, want offset 1 format 0x02", de.Offset, de.Format)
+	}
+}
+
+type testHidden struct {
+	Secret string `msgpack:"secret"`
+}
+
+func TestUnmarshalUnsettableEmbedded(t *testing.T) {
+	var v struct {
+		*testHidden
+		Name string `msgpack:"name"`
+	}
+
+	if err := Unmarshal([]byte{0x81, 0xA4, 'n', 'a', 'm', 'e', 0xA1, 'n'}, &v); err != nil || v.Name != "n" {
+		t.Fatalf("Unmarshal() = %+v, %v, want name n", v, err)
+	}
+
+	input := []byte{0x81, 0xA6, 's', 'e', 'c', 'r', 'e', 't', 0xA1, 's'}
+	if err := Unmarshal(input, &v); !errors.Is(err, ErrUnsettableEmbedded) {
+		t.Errorf("Unmarshal() error = %v, wantErr %v", err, ErrUnsettableEmbedded)
+	}
+}
@@ -0,0 +1,190 @@
+package msgpack
+
+import (
+	"bytes"
+	"io"
+)
+
+// Visitor receives the parts of a MessagePack value as Walk meets them.
+// Offsets are positions in the data passed to Walk: the format byte of
+// the array, map, key or scalar, and for ExitArray and ExitMap the byte
+// after the container's last element.
+//
+// Returning SkipSubtree from EnterArray or EnterMap passes over the
+// container without visiting its elements or calling ExitArray or ExitMap;
+// from Key it passes over the value of that key. From Scalar, ExitArray and
+// ExitMap there is nothing left to pass over, so it is treated as nil.
+// Returning StopWalk ends the walk and makes Walk return nil. Any other
+// error ends the walk and is returned by Walk as is.
+type Visitor interface {
+	EnterArray(offset int64, length int) error
+	ExitArray(offset int64) error
+	EnterMap(offset int64, length int) error
+	ExitMap(offset int64) error
+
+	// Key is called with each map key, decoded as Decode would.
+	Key(offset int64, key interface{}) error
+
+	// Scalar is called with every value that is not an array or map,
+	// decoded as Decode would.
+	Scalar(offset int64, value interface{}) error
+}
+
+// Walk calls v for every part of the MessagePack value in data, with the
+// zero Options.
+func Walk(data []byte, v Visitor) error {
+	return Options{}.Walk(data, v)
+}
+
+// Walk calls v for every part of the MessagePack value in data, in the
+// order they are encoded, without building the value in memory. Payloads
+// are decoded one at a time and containers passed over with SkipSubtree are
+// never decoded. The limits of o.Decoder apply, with MaxAlloc bounding each
+// key and scalar rather than the whole value.
+//
+// Errors from decoding are *DecodeError values, and data after the value
+// fails with ErrTrailingData.
+func (o Options) Walk(data []byte, v Visitor) error {
+	w := &walker{
+		dec: NewDecoderWithOptions(bytes.NewReader(data), o.Decoder),
+		v:   v,
+	}
+
+	err := w.value()
+	if err == StopWalk {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if b, offset, err := w.dec.readFormat(); err != io.EOF {
+		if err == nil {
+			err = &DecodeError{Offset: offset, Format: b, Err: ErrTrailingData}
+		}
+		return err
+	}
+	return nil
+}
+
+// walker carries the state of one Walk call.
+type walker struct {
+	dec *MessagePackDecoder
+	v   Visitor
+}
+
+// value visits the next value.
+func (w *walker) value() error {
+	dec := w.dec
+
+	b, offset, err := dec.readFormat()
+	if err != nil {
+		return err
+	}
+	dec.traceFormat("walk", offset, b)
+
+	length, isMap, isContainer, err := dec.readContainerHeader(b)
+	if err != nil {
+		return newDecodeError(err, offset, b)
+	}
+	if isContainer {
+		slots := 1
+		if isMap {
+			slots = 2
+		}
+		if err := dec.checkContainer(length, slots); err != nil {
+			return newDecodeError(err, offset, b)
+		}
+
+		if isMap {
+			return w.object(offset, length)
+		}
+		return w.array(offset, length)
+	}
+
+	dec.allocated = 0
+	v, err := dec.decodeFormat(b)
+	if err != nil {
+		return newDecodeError(err, offset, b)
+	}
+
+	return ignoreSkip(w.v.Scalar(offset, v))
+}
+
+func (w *walker) array(offset int64, length int) error {
+	dec := w.dec
+
+	dec.depth++
+	defer dec.leaveContainer()
+
+	switch err := w.v.EnterArray(offset, length); err {
+	case nil:
+	case SkipSubtree:
+		return w.skip(length)
+	default:
+		return err
+	}
+
+	for i := 0; i < length; i++ {
+		if err := w.value(); err != nil {
+			return withIndex(err, i)
+		}
+	}
+	return ignoreSkip(w.v.ExitArray(dec.reader.offset))
+}
+
+func (w *walker) object(offset int64, length int) error {
+	dec := w.dec
+
+	dec.depth++
+	defer dec.leaveContainer()
+
+	switch err := w.v.EnterMap(offset, length); err {
+	case nil:
+	case SkipSubtree:
+		return w.skip(2 * length)
+	default:
+		return err
+	}
+
+	for i := 0; i < length; i++ {
+		keyOffset := dec.reader.offset
+		dec.allocated = 0
+		key, err := dec.decode()
+		if err != nil {
+			return err
+		}
+
+		switch err = w.v.Key(keyOffset, key); err {
+		case nil:
+			err = w.value()
+		case SkipSubtree:
+			err = dec.skip()
+		default:
+			return err
+		}
+		if err != nil {
+			return withKey(err, key)
+		}
+	}
+	return ignoreSkip(w.v.ExitMap(dec.reader.offset))
+}
+
+// ignoreSkip turns SkipSubtree from a callback with nothing to skip into
+// nil.
+func ignoreSkip(err error) error {
+	if err == SkipSubtree {
+		return nil
+	}
+	return err
+}
+
+// skip passes over n values.
+func (w *walker) skip(n int) error {
+	for i := 0; i < n; i++ {
+		if err := w.dec.skip(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package msgpack
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// recordingVisitor logs every callback, and returns the error in results for
+// the callback logged as that string.
+type recordingVisitor struct {
+	events  []string
+	results map[string]error
+}
+
+func (r *recordingVisitor) record(event string) error {
+	r.events = append(r.events, event)
+	return r.results[event]
+}
+
+func (r *recordingVisitor) EnterArray(offset int64, length int) error {
+	return r.record(fmt.Sprintf("%d [%d", offset, length))
+}
+
+func (r *recordingVisitor) ExitArray(offset int64) error {
+	return r.record(fmt.Sprintf("%d ]", offset))
+}
+
+func (r *recordingVisitor) EnterMap(offset int64, length int) error {
+	return r.record(fmt.Sprintf("%d {%d", offset, length))
+}
+
+func (r *recordingVisitor) ExitMap(offset int64) error {
+	return r.record(fmt.Sprintf("%d }", offset))
+}
+
+func (r *recordingVisitor) Key(offset int64, key interface{}) error {
+	return r.record(fmt.Sprintf("%d key %v", offset, key))
+}
+
+func (r *recordingVisitor) Scalar(offset int64, value interface{}) error {
+	return r.record(fmt.Sprintf("%d %v", offset, value))
+}
+
+func TestWalk(t *testing.T) {
+	// {"a": [1, "x"], "b": {"c": nil}}
+	input := []byte{0x82, 0xA1, 'a', 0x92, 0x01, 0xA1, 'x', 0xA1, 'b', 0x81, 0xA1, 'c', 0xC0}
+
+	tests := []struct {
+		name     string
+		results  map[string]error
+		expected []string
+	}{
+		{
+			name:     "everything",
+			expected: []string{"0 {2", "1 key a", "3 [2", "4 1", "5 x", "7 ]", "7 key b", "9 {1", "10 key c", "12 <nil>", "13 }", "13 }"},
+		},
+		{
+			name:     "skip array",
+			results:  map[string]error{"3 [2": SkipSubtree},
+			expected: []string{"0 {2", "1 key a", "3 [2", "7 key b", "9 {1", "10 key c", "12 <nil>", "13 }", "13 }"},
+		},
+		{
+			name:     "skip value of key",
+			results:  map[string]error{"7 key b": SkipSubtree},
+			expected: []string{"0 {2", "1 key a", "3 [2", "4 1", "5 x", "7 ]", "7 key b", "13 }"},
+		},
+		{
+			name:     "skip from exit and scalar is ignored",
+			results:  map[string]error{"7 ]": SkipSubtree, "12 <nil>": SkipSubtree, "13 }": SkipSubtree},
+			expected: []string{"0 {2", "1 key a", "3 [2", "4 1", "5 x", "7 ]", "7 key b", "9 {1", "10 key c", "12 <nil>", "13 }", "13 }"},
+		},
+		{
+			name:     "stop",
+			results:  map[string]error{"4 1": StopWalk},
+			expected: []string{"0 {2", "1 key a", "3 [2", "4 1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &recordingVisitor{results: tt.results}
+			if err := Walk(input, v); err != nil {
+				t.Fatalf("Walk() error = %v", err)
+			}
+			if !reflect.DeepEqual(v.events, tt.expected) {
+				t.Errorf("Walk() visited %q, want %q", v.events, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWalkVisitorError(t *testing.T) {
+	visitErr := errors.New("redacted field")
+	v := &recordingVisitor{results: map[string]error{"2 key x": visitErr}}
+
+	if err := Walk([]byte{0x91, 0x81, 0xA1, 'x', 0x01}, v); err != visitErr {
+		t.Errorf("Walk() error = %v, want %v", err, visitErr)
+	}
+}
+
+func TestWalkErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []byte
+		opts     Options
+		wantErr  error
+		wantPath string
+	}{
+		{name: "truncated", input: []byte{0x92, 0x01}, wantErr: ErrLengthExceedsInput},
+		{name: "truncated payload", input: []byte{0x91, 0xA3, 'a'}, wantErr: ErrLengthExceedsInput, wantPath: "[0]"},
+		{name: "never used", input: []byte{0x81, 0xA1, 'a', 0xC1}, wantErr: ErrUnsupportedType, wantPath: "a"},
+		{name: "trailing data", input: []byte{0xC0, 0xC0}, wantErr: ErrTrailingData},
+		{name: "max depth", input: []byte{0x91, 0x91, 0x90}, opts: Options{Decoder: DecoderOptions{MaxDepth: 2}}, wantErr: ErrMaxDepthExceeded, wantPath: "[0][0]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Walk(tt.input, &recordingVisitor{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Walk() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var de *DecodeError
+			if !errors.As(err, &de) {
+				t.Fatalf("Walk() error = %#v, want a *DecodeError", err)
+			}
+			if de.Path != tt.wantPath {
+				t.Errorf("Walk() error path = %q, want %q", de.Path, tt.wantPath)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package msgpack
+
+import (
+	"bufio"
+	"io"
+)
+
+// Writer emits MessagePack one header or scalar at a time, for code that
+// knows the shape of its output and wants to skip building Go values for
+// Marshal. Arrays and maps are written as a header followed by their
+// elements, or by their keys and values in turn:
+//
+//	w.WriteMapHeader(1)
+//	w.WriteString("ids")
+//	w.WriteArrayHeader(2)
+//	w.WriteUint(1)
+//	w.WriteUint(2)
+//
+// The Writer does not check that the elements match the headers. Each value
+// takes the smallest format that holds it, except for WriteFloat32 and
+// WriteFloat64. The first error is kept and returned by every later call.
+type Writer struct {
+	w   writer
+	bw  *bufio.Writer // set when w buffers an io.Writer the Writer was given
+	err error
+}
+
+// NewWriter returns a Writer that writes to w. A *bytes.Buffer or
+// *bufio.Writer is written to directly; other writers are buffered, and
+// Flush must be called once the output is complete.
+func NewWriter(w io.Writer) *Writer {
+	if w, ok := w.(writer); ok {
+		return &Writer{w: w}
+	}
+	bw := bufio.NewWriter(w)
+	return &Writer{w: bw, bw: bw}
+}
+
+// Flush writes any buffered data to the underlying io.Writer.
+func (w *Writer) Flush() error {
+	if w.err == nil && w.bw != nil {
+		w.err = w.bw.Flush()
+	}
+	return w.err
+}
+
+// WriteArrayHeader starts an array of n elements.
+func (w *Writer) WriteArrayHeader(n int) error {
+	if w.err == nil {
+		w.err = encodeArrayHeader(w.w, n)
+	}
+	return w.err
+}
+
+// WriteMapHeader starts a map of n entries.
+func (w *Writer) WriteMapHeader(n int) error {
+	if w.err == nil {
+		w.err = encodeMapHeader(w.w, n)
+	}
+	return w.err
+}
+
+// WriteString writes s as str.
+func (w *Writer) WriteString(s string) error {
+	if w.err == nil {
+		w.err = encodeString(w.w, s)
+	}
+	return w.err
+}
+
+// WriteBin writes data as bin.
+func (w *Writer) WriteBin(data []byte) error {
+	if w.err == nil {
+		w.err = encodeBin(w.w, data)
+	}
+	return w.err
+}
+
+// WriteExt writes an extension value of type extType.
+func (w *Writer) WriteExt(extType int8, data []byte) error {
+	if w.err == nil {
+		w.err = encodeExt(w.w, extType, data)
+	}
+	return w.err
+}
+
+// WriteInt writes v in a fixint or int format.
+func (w *Writer) WriteInt(v int64) error {
+	if w.err == nil {
+		w.err = encodeInt(w.w, v)
+	}
+	return w.err
+}
+
+// WriteUint writes v in a positive fixint or uint format.
+func (w *Writer) WriteUint(v uint64) error {
+	if w.err == nil {
+		w.err = encodeUint(w.w, v)
+	}
+	return w.err
+}
+
+// WriteFloat32 writes v as float 32.
+func (w *Writer) WriteFloat32(v float32) error {
+	if w.err == nil {
+		w.err = encodeFloat32(w.w, v)
+	}
+	return w.err
+}
+
+// WriteFloat64 writes v as float 64.
+func (w *Writer) WriteFloat64(v float64) error {
+	if w.err == nil {
+		w.err = encodeFloat64(w.w, v)
+	}
+	return w.err
+}
+
+// WriteNil writes nil.
+func (w *Writer) WriteNil() error {
+	if w.err == nil {
+		w.err = encodeNil(w.w, nil)
+	}
+	return w.err
+}
+
+// WriteBool writes true or false.
+func (w *Writer) WriteBool(v bool) error {
+	if w.err == nil {
+		w.err = encodeBool(w.w, v)
+	}
+	return w.err
+}
+
+// WriteRaw writes data as is. It must hold complete MessagePack values, such
+// as the output of Marshal.
+func (w *Writer) WriteRaw(data []byte) error {
+	if w.err == nil {
+		_, w.err = w.w.Write(data)
+	}
+	return w.err
+}
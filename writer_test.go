@@ -0,0 +1,84 @@
+package msgpack
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	tests := []struct {
+		name     string
+		write    func(w *Writer) error
+		expected []byte
+		wantErr  error
+	}{
+		{name: "array header", write: func(w *Writer) error { return w.WriteArrayHeader(16) }, expected: []byte{0xDC, 0x00, 0x10}},
+		{name: "map header", write: func(w *Writer) error { return w.WriteMapHeader(1) }, expected: []byte{0x81}},
+		{name: "negative array header", write: func(w *Writer) error { return w.WriteArrayHeader(-1) }, wantErr: ErrValueOutOfRange},
+		{name: "negative map header", write: func(w *Writer) error { return w.WriteMapHeader(-3) }, wantErr: ErrValueOutOfRange},
+		{name: "string", write: func(w *Writer) error { return w.WriteString("a") }, expected: []byte{0xA1, 'a'}},
+		{name: "bin", write: func(w *Writer) error { return w.WriteBin([]byte{1}) }, expected: []byte{0xC4, 0x01, 0x01}},
+		{name: "ext", write: func(w *Writer) error { return w.WriteExt(5, []byte{1, 2}) }, expected: []byte{0xD5, 0x05, 0x01, 0x02}},
+		{name: "int", write: func(w *Writer) error { return w.WriteInt(-33) }, expected: []byte{0xD0, 0xDF}},
+		{name: "uint", write: func(w *Writer) error { return w.WriteUint(256) }, expected: []byte{0xCD, 0x01, 0x00}},
+		{name: "float 32", write: func(w *Writer) error { return w.WriteFloat32(1.5) }, expected: []byte{0xCA, 0x3F, 0xC0, 0x00, 0x00}},
+		{name: "float 64", write: func(w *Writer) error { return w.WriteFloat64(1.5) }, expected: []byte{0xCB, 0x3F, 0xF8, 0, 0, 0, 0, 0, 0}},
+		{name: "nil", write: func(w *Writer) error { return w.WriteNil() }, expected: []byte{0xC0}},
+		{name: "bool", write: func(w *Writer) error { return w.WriteBool(true) }, expected: []byte{0xC3}},
+		{name: "raw", write: func(w *Writer) error { return w.WriteRaw([]byte{0x91, 0x01}) }, expected: []byte{0x91, 0x01}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tt.write(NewWriter(&buf)); err != tt.wantErr {
+				t.Fatalf("write error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !bytes.Equal(buf.Bytes(), tt.expected) {
+				t.Errorf("wrote % X, want % X", buf.Bytes(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestWriterMatchesMarshal(t *testing.T) {
+	var out bytes.Buffer
+	w := NewWriter(struct{ io.Writer }{&out})
+	w.WriteMapHeader(2)
+	w.WriteString("id")
+	w.WriteInt(7)
+	w.WriteString("tags")
+	w.WriteArrayHeader(2)
+	w.WriteString("a")
+	w.WriteNil()
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	expected, err := Marshal(struct {
+		ID   int           `msgpack:"id"`
+		Tags []interface{} `msgpack:"tags"`
+	}{ID: 7, Tags: []interface{}{"a", nil}})
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), expected) {
+		t.Errorf("wrote % X, want % X", out.Bytes(), expected)
+	}
+}
+
+func TestWriterError(t *testing.T) {
+	writeErr := errors.New("connection reset")
+	w := NewWriter(&failingWriter{err: writeErr})
+
+	if err := w.WriteString("value"); err != nil {
+		t.Fatalf("WriteString() error = %v, want nil until Flush", err)
+	}
+	if err := w.Flush(); err != writeErr {
+		t.Fatalf("Flush() error = %v, wantErr %v", err, writeErr)
+	}
+	if err := w.WriteNil(); err != writeErr {
+		t.Errorf("WriteNil() error = %v, wantErr %v", err, writeErr)
+	}
+}